@@ -0,0 +1,25 @@
+package goChat
+
+import (
+	"context"
+	"time"
+)
+
+type AccountDeletionService interface {
+	// Schedules the deletion of userId once the grace period has passed.
+	// Returns the time at which the account will be deleted.
+	// Requesting deletion again keeps the original schedule.
+	//
+	// Returns ENotFound if user doesn't exist.
+	RequestDeletion(ctx context.Context, userId Id) (time.Time, error)
+
+	// Cancels a scheduled deletion of userId.
+	//
+	// Returns ENotFound if user doesn't exist or no deletion is scheduled.
+	CancelDeletion(ctx context.Context, userId Id) error
+
+	// Deletes every account whose grace period has passed, together with
+	// its sessions, credentials, profile and everything else referencing it.
+	// Returns the number of deleted accounts.
+	PurgeDueAccounts(ctx context.Context) (int, error)
+}
@@ -0,0 +1,49 @@
+package goChat
+
+import (
+	"context"
+	"time"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditUserSuspended    = "user.suspended"
+	AuditSuspensionLifted = "user.suspension_lifted"
+	// Recorded with ActorId 0 when a suspension runs out.
+	AuditSuspensionExpired = "user.suspension_expired"
+	AuditRoleAssigned      = "role.assigned"
+	AuditRoleRevoked       = "role.revoked"
+)
+
+// Represents an administrative action.
+type AuditEntry struct {
+	Id Id
+	// Id of the user who performed the action, 0 for the system.
+	ActorId      Id
+	Action       string
+	TargetUserId Id
+	// Free form details, e.g. the reason of a suspension.
+	Detail string
+
+	CreatedAt time.Time
+}
+
+// Represents a filter used by FindAuditEntries.
+// Zero fields are ignored.
+type AuditFilter struct {
+	ActorId      Id
+	TargetUserId Id
+	Action       string
+
+	// Keyset pagination, only entries with an id less than BeforeId are
+	// returned. Pass the id of the last entry of the previous page.
+	BeforeId Id
+	// Max number of entries returned, 0 means no limit.
+	Limit int
+}
+
+type AuditLogService interface {
+	// Retrieves audit entries matching filter, most recent first.
+	// Requires PermViewAuditLog.
+	FindAuditEntries(ctx context.Context, filter AuditFilter) ([]*AuditEntry, error)
+}
@@ -6,29 +6,65 @@ import (
 )
 
 // [16]byte array encoded to base64URL string.
+// Only clients hold the raw value, services store a SHA-256 digest of it.
 type SessionId string
 
 // Represents a session.
 type Session struct {
 	Id     SessionId
 	UserId Id
+	// Moves forward while the session is in use, up to MaxExpiry.
 	Expiry time.Time
+	// Absolute end of the session, fixed at login.
+	MaxExpiry time.Time
+}
+
+// Represents a password change requested by a logged in user.
+type PasswordChange struct {
+	OldPassword string
+	NewPassword string
+
+	// Delete every session of the user except CurrentSession.
+	RevokeOtherSessions bool
+	CurrentSession      SessionId
+}
+
+// Represents what a user enters to log in.
+type Credentials struct {
+	// Username or email address.
+	Login    string
+	Password string
+	// Picks a longer session lifetime.
+	RememberMe bool
 }
 
 type AuthService interface {
 	// Verifies user and creates new session for specified user.
-	// Returns id of created session.
+	// Returns id of created session. rememberMe picks a longer lifetime.
 	//
 	// Returns ENotFound if user doesn't exist.
-	// Returns EUnauthorized if credentials are invalid.
-	Login(ctx context.Context, user User, password string) (Session, error)
+	// Returns EUnauthorized if credentials are invalid or the implementation
+	// requires a verified email address and the user isn't verified.
+	// Returns ESuspended if the user is suspended.
+	Login(ctx context.Context, user User, password string, rememberMe bool) (Session, error)
+
+	// Looks the user up by credentials.Login, which may be a username or
+	// an email address, and creates a new session if the password matches.
+	// Response times don't reveal whether the user exists.
+	//
+	// Returns EUnauthorized with the same message for every failed login:
+	// unknown users, wrong passwords, suspended users and, if the
+	// implementation requires it, unverified email addresses.
+	LoginWithCredentials(ctx context.Context, credentials Credentials) (Session, error)
 
 	// Deletes specified session.
 	DeleteSession(ctx context.Context, sessionId SessionId) error
 
-	// Retrieves a single session by sessionId.
+	// Retrieves a single session by sessionId and extends its expiry, except
+	// for sessions created before renewal existed, which keep their expiry.
 	//
-	// Returns ENotFound error if specified sessionId doesn't exist.
+	// Returns ENotFound error if specified sessionId doesn't exist or has expired.
+	// Returns ESuspended if the session's user is suspended.
 	FindSession(ctx context.Context, sessionId SessionId) (*Session, error)
 
 	// Returns true if credentials are valid.
@@ -36,4 +72,11 @@ type AuthService interface {
 	// Returns ENotFound if user doesn't exist.
 	// Can return EInternal.
 	VerifyUser(ctx context.Context, user User, password string) (bool, error)
+
+	// Verifies change.OldPassword and replaces it with change.NewPassword.
+	//
+	// Returns ENotFound if user doesn't exist.
+	// Returns EUnauthorized if change.OldPassword is invalid.
+	// Returns EInvalid if change.NewPassword violates the password policy.
+	ChangePassword(ctx context.Context, user User, change PasswordChange) error
 }
@@ -0,0 +1,34 @@
+package goChat
+
+import (
+	"context"
+	"time"
+)
+
+// Represents a user blocking another user.
+type Block struct {
+	BlockerId Id
+	BlockedId Id
+
+	CreatedAt time.Time
+}
+
+type BlockService interface {
+	// Blocks blockedId for blockerId. Blocking an already blocked user does nothing.
+	//
+	// Returns ENotFound if either user doesn't exist.
+	// Returns EInvalid if blockerId equals blockedId.
+	Block(ctx context.Context, blockerId, blockedId Id) error
+
+	// Removes the block of blockedId by blockerId.
+	//
+	// Returns ENotFound if blockerId hasn't blocked blockedId.
+	Unblock(ctx context.Context, blockerId, blockedId Id) error
+
+	// Retrieves the blocks created by blockerId, most recent first.
+	FindBlocks(ctx context.Context, blockerId Id) ([]*Block, error)
+
+	// Returns true if either of the users has blocked the other.
+	// Services use it to refuse interactions between the two users.
+	IsBlocked(ctx context.Context, userId1, userId2 Id) (bool, error)
+}
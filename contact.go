@@ -0,0 +1,92 @@
+package goChat
+
+import (
+	"context"
+	"time"
+)
+
+type ContactRequestState string
+
+const (
+	ContactRequestPending  ContactRequestState = "pending"
+	ContactRequestAccepted ContactRequestState = "accepted"
+	ContactRequestDeclined ContactRequestState = "declined"
+	ContactRequestCanceled ContactRequestState = "canceled"
+)
+
+// Represents a friend request. Only pending requests can change state,
+// the recipient may accept or decline it, the sender may cancel it.
+type ContactRequest struct {
+	Id          Id
+	SenderId    Id
+	RecipientId Id
+	State       ContactRequestState
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Represents ContactId in the contact list of UserId.
+type Contact struct {
+	UserId    Id
+	ContactId Id
+	// Name UserId gave ContactId, empty if none.
+	Nickname string
+
+	CreatedAt time.Time
+}
+
+type ContactService interface {
+	// Sends a contact request from senderId to recipientId.
+	//
+	// Returns ENotFound if recipient doesn't exist or either user blocked the other.
+	// Returns EInvalid if senderId equals recipientId.
+	// Returns EConflict if the users are contacts already or a request
+	// between them is pending.
+	SendRequest(ctx context.Context, senderId, recipientId Id) (*ContactRequest, error)
+
+	// Accepts a pending request sent to userId and adds both users to each
+	// other's contact list.
+	//
+	// Returns ENotFound if request doesn't exist or wasn't sent to userId.
+	// Returns EConflict if request isn't pending anymore.
+	AcceptRequest(ctx context.Context, userId, requestId Id) error
+
+	// Declines a pending request sent to userId.
+	//
+	// Returns ENotFound if request doesn't exist or wasn't sent to userId.
+	// Returns EConflict if request isn't pending anymore.
+	DeclineRequest(ctx context.Context, userId, requestId Id) error
+
+	// Cancels a pending request sent by userId.
+	//
+	// Returns ENotFound if request doesn't exist or wasn't sent by userId.
+	// Returns EConflict if request isn't pending anymore.
+	CancelRequest(ctx context.Context, userId, requestId Id) error
+
+	// Retrieves pending requests sent by or to userId, most recent first.
+	FindPendingRequests(ctx context.Context, userId Id) ([]*ContactRequest, error)
+
+	// Retrieves the contact list of userId.
+	FindContacts(ctx context.Context, userId Id) ([]*Contact, error)
+
+	// Sets the nickname userId gave contactId, "" removes it.
+	//
+	// Returns ENotFound if contactId isn't a contact of userId.
+	// Returns EInvalid if nickname is too long.
+	SetNickname(ctx context.Context, userId, contactId Id, nickname string) error
+
+	// Removes the users from each other's contact list.
+	//
+	// Returns ENotFound if contactId isn't a contact of userId.
+	RemoveContact(ctx context.Context, userId, contactId Id) error
+
+	// Sets whether userId only accepts direct messages from contacts.
+	//
+	// Returns ENotFound if user doesn't exist.
+	SetDirectMessagesFromContactsOnly(ctx context.Context, userId Id, contactsOnly bool) error
+
+	// Returns true if senderId may start a direct chat with recipientId,
+	// taking blocks and the recipient's privacy setting into account.
+	CanSendDirectMessage(ctx context.Context, senderId, recipientId Id) (bool, error)
+}
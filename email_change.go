@@ -0,0 +1,31 @@
+package goChat
+
+import "context"
+
+// Pending addresses aren't reserved, so two users may request the same
+// address. Whoever confirms first gets it.
+type EmailChangeService interface {
+	// Mails a single-use confirmation token to newEmail. The user's email
+	// stays unchanged until the token is confirmed. Replaces any pending
+	// change of the user.
+	//
+	// Returns ENotFound if user doesn't exist.
+	// Returns EInvalid if newEmail isn't a valid address or equals the current one.
+	// Returns EConflict if newEmail is already registered.
+	// Returns ERateLimited if a token was sent to the user too recently.
+	RequestEmailChange(ctx context.Context, userId Id, newEmail string) error
+
+	// Changes the user's email to the address the token was issued for and
+	// mails a revert token to the previous address in the background.
+	//
+	// Returns ENotFound if token doesn't exist or has expired.
+	// Returns EConflict if the address was registered in the meantime.
+	ConfirmEmailChange(ctx context.Context, token string) error
+
+	// Restores the address the email was changed from and logs the user
+	// out everywhere, in case the change was made by someone else.
+	//
+	// Returns ENotFound if token doesn't exist or has expired.
+	// Returns EConflict if the previous address was registered in the meantime.
+	RevertEmailChange(ctx context.Context, token string) error
+}
@@ -10,6 +10,11 @@ const (
 	EInternal     ErrCode = 1
 	ENotFound     ErrCode = 2
 	EUnauthorized ErrCode = 3
+	ERateLimited  ErrCode = 4
+	EInvalid      ErrCode = 5
+	EConflict     ErrCode = 6
+	ESuspended    ErrCode = 7
+	EForbidden    ErrCode = 8
 )
 
 type Error struct {
@@ -22,6 +27,8 @@ type Error struct {
 	Op string
 	// Error message for end user.
 	Message string
+	// Name of the input field the error refers to, if any.
+	Field string
 
 	// Nested error.
 	Err error
@@ -46,11 +53,21 @@ func (e Error) ErrMessage() string {
 		return e.Message
 	}
 	if err, ok := e.Err.(Error); ok {
-		err.ErrMessage()
+		return err.ErrMessage()
 	}
 	return "Internal error."
 }
 
+func (e Error) ErrField() string {
+	if e.Field != "" {
+		return e.Field
+	}
+	if err, ok := e.Err.(Error); ok {
+		return err.ErrField()
+	}
+	return ""
+}
+
 func NewInternalErr(info, op, message string, err error) Error {
 	return Error{Code: EInternal, Info: info, Op: op, Err: err, Message: message}
 }
@@ -58,3 +75,37 @@ func NewInternalErr(info, op, message string, err error) Error {
 func NewNotFoundErr(info, op, message string, err error) Error {
 	return Error{Code: ENotFound, Info: info, Op: op, Err: err, Message: message}
 }
+
+func NewUnauthorizedErr(info, op, message string, err error) Error {
+	return Error{Code: EUnauthorized, Info: info, Op: op, Err: err, Message: message}
+}
+
+func NewRateLimitedErr(info, op, message string, err error) Error {
+	return Error{Code: ERateLimited, Info: info, Op: op, Err: err, Message: message}
+}
+
+func NewInvalidErr(info, op, message string, err error) Error {
+	return Error{Code: EInvalid, Info: info, Op: op, Err: err, Message: message}
+}
+
+func NewConflictErr(info, op, message string, err error) Error {
+	return Error{Code: EConflict, Info: info, Op: op, Err: err, Message: message}
+}
+
+// Returns EInvalid referring to the input field.
+func NewInvalidFieldErr(field, info, op, message string, err error) Error {
+	return Error{Code: EInvalid, Field: field, Info: info, Op: op, Err: err, Message: message}
+}
+
+// Returns EConflict referring to the input field.
+func NewConflictFieldErr(field, info, op, message string, err error) Error {
+	return Error{Code: EConflict, Field: field, Info: info, Op: op, Err: err, Message: message}
+}
+
+func NewSuspendedErr(info, op, message string, err error) Error {
+	return Error{Code: ESuspended, Info: info, Op: op, Err: err, Message: message}
+}
+
+func NewForbiddenErr(info, op, message string, err error) Error {
+	return Error{Code: EForbidden, Info: info, Op: op, Err: err, Message: message}
+}
@@ -0,0 +1,57 @@
+package goChat
+
+import (
+	"context"
+	"time"
+)
+
+type ExportStatus string
+
+const (
+	ExportPending ExportStatus = "pending"
+	ExportRunning ExportStatus = "running"
+	ExportDone    ExportStatus = "done"
+	ExportFailed  ExportStatus = "failed"
+)
+
+// Represents an export of all data stored about a user.
+type DataExport struct {
+	Id     Id
+	UserId Id
+	Status ExportStatus
+	// Percentage of the export that is done, 0-100.
+	Progress int
+	// Name of the finished ZIP archive, used to build the download link.
+	// Empty until Status is ExportDone.
+	FileName string
+	// Number of times building the archive was started. An export whose
+	// worker stopped responding is started again.
+	Attempts int
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// The archive is deleted after ExpiresAt. Zero until Status is ExportDone.
+	ExpiresAt time.Time
+}
+
+type DataExportService interface {
+	// Queues an export of all data stored about userId. If an export of the
+	// user is already pending or running, that export is returned instead.
+	//
+	// Returns ENotFound if user doesn't exist.
+	RequestExport(ctx context.Context, userId Id) (*DataExport, error)
+
+	// Retrieves the most recent export of userId.
+	//
+	// Returns ENotFound if user has no export.
+	FindExport(ctx context.Context, userId Id) (*DataExport, error)
+
+	// Builds the archive of the oldest pending export, or of a running
+	// export whose worker stopped updating it.
+	// Returns false if no export was pending.
+	ProcessNextExport(ctx context.Context) (bool, error)
+
+	// Deletes expired archives and their exports.
+	// Returns the number of deleted exports.
+	PruneExpiredExports(ctx context.Context) (int, error)
+}
@@ -5,6 +5,7 @@ go 1.20
 require (
 	github.com/mattn/go-sqlite3 v1.14.16
 	golang.org/x/crypto v0.9.0
+	golang.org/x/text v0.9.0
 )
 
 require golang.org/x/sys v0.8.0 // indirect
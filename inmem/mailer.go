@@ -0,0 +1,47 @@
+package inmem
+
+import (
+	"context"
+	"sync"
+
+	"github.com/adamni21/goChat"
+)
+
+// Mailer keeps sent mails in memory instead of delivering them.
+// Meant for tests and local development.
+type Mailer struct {
+	mu    sync.Mutex
+	mails []goChat.Mail
+}
+
+// returns new instance of Mailer
+func NewMailer() *Mailer {
+	return &Mailer{}
+}
+
+// Stores mail.
+func (m *Mailer) Send(ctx context.Context, mail goChat.Mail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mails = append(m.mails, mail)
+	return nil
+}
+
+// Returns all mails sent so far.
+func (m *Mailer) Mails() []goChat.Mail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]goChat.Mail(nil), m.mails...)
+}
+
+// Returns the last mail sent to the specified address and whether one exists.
+func (m *Mailer) LastMailTo(to string) (goChat.Mail, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.mails) - 1; i >= 0; i-- {
+		if m.mails[i].To == to {
+			return m.mails[i], true
+		}
+	}
+	return goChat.Mail{}, false
+}
@@ -0,0 +1,15 @@
+package goChat
+
+import "context"
+
+// Represents a plain text email.
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	// Delivers mail to mail.To.
+	Send(ctx context.Context, mail Mail) error
+}
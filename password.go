@@ -0,0 +1,26 @@
+package goChat
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 128
+)
+
+// Checks password against the password policy.
+//
+// Returns EInvalid with Field "password" if password violates the policy.
+func ValidatePassword(password string) error {
+	const op = "goChat.ValidatePassword"
+	n := utf8.RuneCountInString(password)
+	if n < MinPasswordLength {
+		return NewInvalidFieldErr("password", "", op, fmt.Sprintf("Password must be at least %d characters long.", MinPasswordLength), nil)
+	}
+	if n > MaxPasswordLength {
+		return NewInvalidFieldErr("password", "", op, fmt.Sprintf("Password must be at most %d characters long.", MaxPasswordLength), nil)
+	}
+	return nil
+}
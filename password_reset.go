@@ -0,0 +1,18 @@
+package goChat
+
+import "context"
+
+type PasswordResetService interface {
+	// Mails a single-use reset token to email if a user with that email exists.
+	//
+	// Returns nil whether or not email is registered or delivery fails, so
+	// callers can't find out which addresses have an account.
+	RequestReset(ctx context.Context, email string) error
+
+	// Sets the password of the user the token was issued for, invalidates
+	// the token and deletes all sessions of the user.
+	//
+	// Returns ENotFound if token doesn't exist or has expired.
+	// Returns EInvalid if newPassword violates the password policy.
+	ResetPassword(ctx context.Context, token, newPassword string) error
+}
@@ -0,0 +1,200 @@
+package goChat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Describes a registered preference. Values are stored JSON encoded.
+type PreferenceSchema struct {
+	Key string
+	// JSON encoded value used while the user hasn't set the preference.
+	Default json.RawMessage
+	// Returns the JSON encoded value re-encoded from its decoded form, so
+	// only what the schema knows is stored, or an error if it isn't valid.
+	Normalize func(value json.RawMessage) (json.RawMessage, error)
+}
+
+// Typed handle of a registered preference, see RegisterPreference.
+type Preference[T any] struct {
+	Key     string
+	Default T
+	// Optional, returns an error if value isn't allowed.
+	Validate func(value T) error
+}
+
+var (
+	preferencesMu sync.RWMutex
+	preferences   = make(map[string]PreferenceSchema)
+)
+
+// Registers p so its values can be stored and returns p.
+// Panics if a preference with the same key is already registered.
+func RegisterPreference[T any](p Preference[T]) Preference[T] {
+	def, err := json.Marshal(p.Default)
+	if err != nil {
+		panic(fmt.Sprintf("goChat: encoding default of preference %q: %v", p.Key, err))
+	}
+	schema := PreferenceSchema{
+		Key:     p.Key,
+		Default: def,
+		Normalize: func(raw json.RawMessage) (json.RawMessage, error) {
+			v, err := p.decode(raw)
+			if err != nil {
+				return nil, err
+			}
+			return json.Marshal(v)
+		},
+	}
+
+	preferencesMu.Lock()
+	defer preferencesMu.Unlock()
+	if _, ok := preferences[p.Key]; ok {
+		panic(fmt.Sprintf("goChat: preference %q registered twice", p.Key))
+	}
+	preferences[p.Key] = schema
+	return p
+}
+
+// Returns the schema of the preference registered with key.
+func LookupPreference(key string) (PreferenceSchema, bool) {
+	preferencesMu.RLock()
+	defer preferencesMu.RUnlock()
+	schema, ok := preferences[key]
+	return schema, ok
+}
+
+// Returns the schemas of all registered preferences.
+func Preferences() []PreferenceSchema {
+	preferencesMu.RLock()
+	defer preferencesMu.RUnlock()
+	schemas := make([]PreferenceSchema, 0, len(preferences))
+	for _, schema := range preferences {
+		schemas = append(schemas, schema)
+	}
+	return schemas
+}
+
+// Retrieves the value of p for userId. Returns p.Default if the user
+// hasn't set p or the stored value doesn't match the schema anymore.
+func (p Preference[T]) Get(ctx context.Context, s PreferenceService, userId Id) (T, error) {
+	value, err := s.FindPreference(ctx, userId, p.Key)
+	if err != nil {
+		return p.Default, err
+	}
+	v, err := p.decode(value.Value)
+	if err != nil {
+		return p.Default, nil
+	}
+	return v, nil
+}
+
+// Sets the value of p for userId, overwriting changes of other devices.
+//
+// Returns EInvalid if value isn't allowed.
+func (p Preference[T]) Set(ctx context.Context, s PreferenceService, userId Id, value T) (*PreferenceValue, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, NewInvalidErr("", "goChat.Preference.Set", "Invalid preference value.", err)
+	}
+	return s.SetPreference(ctx, userId, PreferenceUpdate{Key: p.Key, Value: raw})
+}
+
+// Decodes raw into a T. Rejects null, which would decode to the zero
+// value instead of failing.
+func (p Preference[T]) decode(raw json.RawMessage) (T, error) {
+	const op = "goChat.Preference.decode"
+	var v T
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return v, NewInvalidFieldErr(p.Key, "", op, "Invalid preference value.", nil)
+	}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return v, NewInvalidFieldErr(p.Key, "", op, "Invalid preference value.", err)
+	}
+	if p.Validate != nil {
+		if err := p.Validate(v); err != nil {
+			return v, NewInvalidFieldErr(p.Key, "", op, "Invalid preference value.", err)
+		}
+	}
+	return v, nil
+}
+
+// Represents the value of a preference of a user.
+type PreferenceValue struct {
+	Key   string
+	Value json.RawMessage
+	// Version of the user's preferences when this value was set,
+	// 0 if the value is the default.
+	Version int64
+
+	UpdatedAt time.Time
+}
+
+// Represents a change of a preference.
+type PreferenceUpdate struct {
+	Key   string
+	Value json.RawMessage
+	// Optional, the Version of the value the change is based on.
+	// The update fails if the value was changed since.
+	BaseVersion *int64
+}
+
+type PreferenceService interface {
+	// Retrieves the value of every registered preference of userId,
+	// defaults included.
+	FindPreferences(ctx context.Context, userId Id) ([]*PreferenceValue, error)
+
+	// Retrieves the value of a single preference of userId.
+	//
+	// Returns EInvalid if no preference is registered with key.
+	FindPreference(ctx context.Context, userId Id, key string) (*PreferenceValue, error)
+
+	// Retrieves the preferences of userId changed after sinceVersion and
+	// the current version, which a device passes as sinceVersion next time.
+	FindPreferenceChanges(ctx context.Context, userId Id, sinceVersion int64) ([]*PreferenceValue, int64, error)
+
+	// Validates and stores a preference value and bumps the user's version.
+	//
+	// Returns ENotFound if user doesn't exist.
+	// Returns EInvalid if key isn't registered or the value doesn't match its schema.
+	// Returns EConflict if upd.BaseVersion is set and the value changed since.
+	SetPreference(ctx context.Context, userId Id, upd PreferenceUpdate) (*PreferenceValue, error)
+}
+
+var (
+	PrefLocale = RegisterPreference(Preference[string]{
+		Key:     "locale",
+		Default: "en",
+		Validate: func(v string) error {
+			if len(v) < 2 || len(v) > 35 {
+				return fmt.Errorf("invalid locale %q", v)
+			}
+			return nil
+		},
+	})
+	PrefTimeZone = RegisterPreference(Preference[string]{
+		Key:     "timeZone",
+		Default: "UTC",
+		Validate: func(v string) error {
+			_, err := time.LoadLocation(v)
+			return err
+		},
+	})
+	PrefTheme = RegisterPreference(Preference[string]{
+		Key:     "theme",
+		Default: "system",
+		Validate: func(v string) error {
+			if v != "system" && v != "light" && v != "dark" {
+				return fmt.Errorf("invalid theme %q", v)
+			}
+			return nil
+		},
+	})
+	PrefNotificationsEnabled = RegisterPreference(Preference[bool]{Key: "notifications.enabled", Default: true})
+	PrefNotificationSound    = RegisterPreference(Preference[bool]{Key: "notifications.sound", Default: true})
+	PrefReadReceipts         = RegisterPreference(Preference[bool]{Key: "privacy.readReceipts", Default: true})
+)
@@ -0,0 +1,68 @@
+package goChat
+
+import (
+	"context"
+	"time"
+)
+
+type PresenceStatus string
+
+const (
+	PresenceOnline  PresenceStatus = "online"
+	PresenceAway    PresenceStatus = "away"
+	PresenceOffline PresenceStatus = "offline"
+)
+
+// Determines who may see a piece of information about a user.
+type Audience string
+
+const (
+	AudienceEveryone Audience = "everyone"
+	AudienceContacts Audience = "contacts"
+	AudienceNobody   Audience = "nobody"
+)
+
+func (a Audience) Valid() bool {
+	switch a {
+	case AudienceEveryone, AudienceContacts, AudienceNobody:
+		return true
+	}
+	return false
+}
+
+// Represents the presence of a user as seen by a specific viewer.
+type Presence struct {
+	UserId Id
+	// Empty if the user hides presence from the viewer.
+	Status PresenceStatus
+	// Zero if the user hides last seen from the viewer or was never seen.
+	LastSeen time.Time
+}
+
+type PresenceService interface {
+	// Records a heartbeat of a device of userId. status must be PresenceOnline
+	// or PresenceAway. A user is online if any device is online, away if all
+	// connected devices are away and offline otherwise.
+	//
+	// Returns EInvalid if status isn't online or away.
+	Heartbeat(ctx context.Context, userId Id, deviceId string, status PresenceStatus) error
+
+	// Marks a device of userId as disconnected.
+	Disconnect(ctx context.Context, userId Id, deviceId string) error
+
+	// Retrieves the presence of userId as seen by viewerId.
+	//
+	// Returns ENotFound if user doesn't exist.
+	FindPresence(ctx context.Context, viewerId, userId Id) (*Presence, error)
+
+	// Sets who may see the presence and the last seen time of userId.
+	//
+	// Returns ENotFound if user doesn't exist.
+	// Returns EInvalid if an audience isn't valid.
+	SetPresencePrivacy(ctx context.Context, userId Id, presence, lastSeen Audience) error
+
+	// Subscribes viewerId to presence changes of userIds. Visibility is
+	// determined once when subscribing. Events are dropped if the channel's
+	// buffer is full. Call the returned func to unsubscribe.
+	Subscribe(ctx context.Context, viewerId Id, userIds []Id) (<-chan Presence, func(), error)
+}
@@ -0,0 +1,66 @@
+package goChat
+
+import (
+	"context"
+	"time"
+)
+
+// Represents a capability granted through roles.
+type Permission string
+
+const (
+	PermManageUsers     Permission = "users.manage"
+	PermManageRoles     Permission = "roles.manage"
+	PermModerateContent Permission = "content.moderate"
+	PermViewAuditLog    Permission = "audit_log.view"
+)
+
+// Names of the built-in roles.
+const (
+	// Holds every permission.
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+)
+
+// Represents a named set of permissions.
+type Role struct {
+	Id          Id
+	Name        string
+	Permissions []Permission
+}
+
+// Represents a role held by a user.
+type UserRole struct {
+	UserId Id
+	Role   *Role
+	// Id of the user who assigned the role, 0 for the system.
+	AssignedBy Id
+
+	CreatedAt time.Time
+}
+
+// Unless stated otherwise the acting user is taken from ctx, see
+// UserIdFromContext. Methods requiring a permission return EUnauthorized if
+// ctx has no user and EForbidden if the user lacks the permission.
+type RoleService interface {
+	// Retrieves all roles, ordered by name.
+	FindRoles(ctx context.Context) ([]*Role, error)
+
+	// Retrieves the roles held by userId, ordered by name.
+	FindUserRoles(ctx context.Context, userId Id) ([]*UserRole, error)
+
+	// Assigns the role named roleName to userId. Requires PermManageRoles.
+	//
+	// Returns ENotFound if the user or role doesn't exist.
+	// Returns EConflict if userId already holds the role.
+	AssignRole(ctx context.Context, userId Id, roleName string) error
+
+	// Revokes the role named roleName from userId. Requires PermManageRoles.
+	//
+	// Returns ENotFound if userId doesn't hold the role.
+	// Returns EConflict when revoking the last admin.
+	RevokeRole(ctx context.Context, userId Id, roleName string) error
+
+	// Returns true if any role of userId grants perm.
+	HasPermission(ctx context.Context, userId Id, perm Permission) (bool, error)
+}
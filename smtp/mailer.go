@@ -0,0 +1,66 @@
+package smtp
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/adamni21/goChat"
+)
+
+// Mailer delivers mails through an SMTP server.
+type Mailer struct {
+	// host:port of the SMTP server.
+	Addr string
+	// Sender address used for the From header and envelope.
+	From string
+	// Optional, nil disables authentication.
+	Auth smtp.Auth
+}
+
+// returns new instance of Mailer
+func NewMailer(addr, from string, auth smtp.Auth) *Mailer {
+	return &Mailer{Addr: addr, From: from, Auth: auth}
+}
+
+// Delivers mail to mail.To.
+func (m *Mailer) Send(ctx context.Context, mail goChat.Mail) error {
+	const op = "smtp.Mailer.Send"
+	if err := ctx.Err(); err != nil {
+		return goChat.NewInternalErr("", op, "", err)
+	}
+
+	msg, err := m.buildMessage(mail)
+	if err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	err = smtp.SendMail(m.Addr, m.Auth, m.From, []string{mail.To}, msg)
+	if err != nil {
+		return goChat.NewInternalErr(fmt.Sprintf("sending mail to %s", mail.To), op, "", err)
+	}
+	return nil
+}
+
+// Returns EInvalid if a header value contains a line break, which would
+// allow injecting headers.
+func (m *Mailer) buildMessage(mail goChat.Mail) ([]byte, error) {
+	const op = "smtp.Mailer.buildMessage"
+	headers := [][2]string{{"From", m.From}, {"To", mail.To}, {"Subject", mail.Subject}}
+	for _, h := range headers {
+		if strings.ContainsAny(h[1], "\r\n") {
+			return nil, goChat.NewInvalidErr(fmt.Sprintf("%s: %q", h[0], h[1]), op, "Mail headers can't contain line breaks.", nil)
+		}
+	}
+
+	var b strings.Builder
+	for _, h := range headers {
+		fmt.Fprintf(&b, "%s: %s\r\n", h[0], h[1])
+	}
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(mail.Body, "\n", "\r\n"))
+	return []byte(b.String()), nil
+}
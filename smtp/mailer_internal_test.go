@@ -0,0 +1,34 @@
+package smtp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adamni21/goChat"
+)
+
+func TestBuildMessage(t *testing.T) {
+	m := NewMailer("localhost:25", "noreply@mail.io", nil)
+
+	t.Run("headers and body", func(t *testing.T) {
+		msg, err := m.buildMessage(goChat.Mail{To: "test@mail.io", Subject: "Hi", Body: "line1\nline2"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "From: noreply@mail.io\r\nTo: test@mail.io\r\nSubject: Hi\r\n"
+		if !strings.HasPrefix(string(msg), want) || !strings.HasSuffix(string(msg), "\r\n\r\nline1\r\nline2") {
+			t.Fatalf("unexpected message %q", msg)
+		}
+	})
+
+	// return EInvalid instead of injecting headers
+	for _, mail := range []goChat.Mail{
+		{To: "test@mail.io\r\nBcc: victim@mail.io", Subject: "Hi"},
+		{To: "test@mail.io", Subject: "Hi\nBcc: victim@mail.io"},
+	} {
+		_, err := m.buildMessage(mail)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EInvalid {
+			t.Fatalf("expected EInvalid for %+v got %+v", mail, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/adamni21/goChat"
+)
+
+const accountDeletionServiceOp = "sqlite.AccountDeletionService."
+
+// AccountDeletionService represents a service for users deleting their account.
+type AccountDeletionService struct {
+	db *DB
+
+	// Time between requesting deletion and the account being deleted,
+	// during which the user can cancel. 0 deletes with the next purge.
+	GracePeriod time.Duration
+}
+
+// returns new instance of AccountDeletionService
+func NewAccountDeletionService(db *DB) *AccountDeletionService {
+	return &AccountDeletionService{
+		db:          db,
+		GracePeriod: 14 * 24 * time.Hour,
+	}
+}
+
+// Schedules the deletion of userId once the grace period has passed.
+// Returns the time at which the account will be deleted.
+// Requesting deletion again keeps the original schedule.
+//
+// Returns ENotFound if user doesn't exist.
+func (s *AccountDeletionService) RequestDeletion(ctx context.Context, userId goChat.Id) (time.Time, error) {
+	const op = accountDeletionServiceOp + "RequestDeletion"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	deleteAt := tx.now.Add(s.GracePeriod)
+	query := `
+		UPDATE users
+		SET deletionScheduledAt = coalesce(deletionScheduledAt, ?)
+		WHERE id = ?
+		RETURNING deletionScheduledAt
+	`
+	err = tx.QueryRowContext(ctx, query, (*NullTime)(&deleteAt), userId).Scan((*NullTime)(&deleteAt))
+	if err != nil {
+		info := fmt.Sprintf("userId: %d", userId)
+		if err == sql.ErrNoRows {
+			return time.Time{}, goChat.NewNotFoundErr(info, op, "User not found.", nil)
+		}
+		return time.Time{}, goChat.NewInternalErr(info, op, "", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return time.Time{}, goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return deleteAt, nil
+}
+
+// Cancels a scheduled deletion of userId.
+//
+// Returns ENotFound if user doesn't exist or no deletion is scheduled.
+func (s *AccountDeletionService) CancelDeletion(ctx context.Context, userId goChat.Id) error {
+	const op = accountDeletionServiceOp + "CancelDeletion"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE users
+		SET deletionScheduledAt = NULL
+		WHERE id = ? AND deletionScheduledAt IS NOT NULL
+	`
+	result, err := tx.ExecContext(ctx, query, userId)
+	if err != nil {
+		return goChat.NewInternalErr("updating users table", op, "", err)
+	}
+	if err = expectRowsAffected(result, op, "No account deletion scheduled."); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
+
+// Deletes every account whose grace period has passed, together with
+// its sessions, credentials, profile and everything else referencing it.
+// Admins are kept scheduled while no other admin would remain, as
+// RevokeRole does, so roles can still be managed.
+// Returns the number of deleted accounts.
+func (s *AccountDeletionService) PurgeDueAccounts(ctx context.Context) (int, error) {
+	const op = accountDeletionServiceOp + "PurgeDueAccounts"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		WITH admins AS (
+			SELECT ur.userId FROM user_roles ur
+			JOIN roles r ON r.id = ur.roleId
+			WHERE r.name = ?2
+		), due AS (
+			SELECT id FROM users
+			WHERE deletionScheduledAt IS NOT NULL AND deletionScheduledAt <= ?1
+		)
+		DELETE FROM users
+		WHERE id IN due AND (
+			id NOT IN admins OR EXISTS (SELECT 1 FROM admins WHERE userId NOT IN due)
+		)
+	`
+	result, err := tx.ExecContext(ctx, query, (*NullTime)(&tx.now), goChat.RoleAdmin)
+	if err != nil {
+		return 0, goChat.NewInternalErr("deleting from users table", op, "", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, goChat.NewInternalErr("getting rows affected", op, "", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return int(n), nil
+}
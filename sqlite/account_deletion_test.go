@@ -0,0 +1,116 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adamni21/goChat"
+	"github.com/adamni21/goChat/sqlite"
+)
+
+func TestAccountDeletion(t *testing.T) {
+	db := MustOpenDB(t)
+	defer MustCloseDB(t, db)
+	ctx := context.Background()
+
+	s := sqlite.NewAccountDeletionService(db)
+	userService := sqlite.NewUserService(db)
+	authService := sqlite.NewAuthService(db)
+	contactService := sqlite.NewContactService(db)
+	alice := MustCreateUser(t, ctx, userService, &goChat.User{Username: "alice", Email: "alice@mail.io"}, "password")
+	bob := MustCreateUser(t, ctx, userService, &goChat.User{Username: "bob", Email: "bob@mail.io"}, "password")
+	MustBeContacts(t, ctx, contactService, alice.Id, bob.Id)
+	session := &goChat.Session{UserId: alice.Id}
+	MustCreateSession(t, ctx, db, session)
+
+	t.Run("cancel during grace period", func(t *testing.T) {
+		deleteAt, err := s.RequestDeletion(ctx, alice.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !deleteAt.After(alice.CreatedAt) {
+			t.Fatalf("deleteAt=%v, want after %v", deleteAt, alice.CreatedAt)
+		}
+
+		// requesting again keeps the schedule
+		if again, err := s.RequestDeletion(ctx, alice.Id); err != nil {
+			t.Fatal(err)
+		} else if !again.Equal(deleteAt) {
+			t.Fatalf("deleteAt=%v, want %v", again, deleteAt)
+		}
+
+		if n, err := s.PurgeDueAccounts(ctx); err != nil {
+			t.Fatal(err)
+		} else if n != 0 {
+			t.Fatalf("purged %d accounts, want 0", n)
+		}
+
+		if err := s.CancelDeletion(ctx, alice.Id); err != nil {
+			t.Fatal(err)
+		}
+		err = s.CancelDeletion(ctx, alice.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		}
+	})
+
+	t.Run("purge after grace period", func(t *testing.T) {
+		s.GracePeriod = 0
+		if _, err := s.RequestDeletion(ctx, alice.Id); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := s.PurgeDueAccounts(ctx); err != nil {
+			t.Fatal(err)
+		} else if n != 1 {
+			t.Fatalf("purged %d accounts, want 1", n)
+		}
+
+		_, err := userService.FindById(ctx, alice.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected user to be deleted got %+v", err)
+		}
+		_, err = authService.FindSession(ctx, session.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected session to be deleted got %+v", err)
+		}
+		if contacts, err := contactService.FindContacts(ctx, bob.Id); err != nil {
+			t.Fatal(err)
+		} else if len(contacts) != 0 {
+			t.Fatalf("expected no contacts got %+v", contacts)
+		}
+	})
+
+	// the last admin is kept until another admin exists
+	t.Run("keep last admin", func(t *testing.T) {
+		roleService := sqlite.NewRoleService(db)
+		if err := roleService.GrantInitialAdmin(ctx, bob.Id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.RequestDeletion(ctx, bob.Id); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := s.PurgeDueAccounts(ctx); err != nil {
+			t.Fatal(err)
+		} else if n != 0 {
+			t.Fatalf("purged %d accounts, want 0", n)
+		}
+
+		carol := MustCreateUser(t, ctx, userService, &goChat.User{Username: "carol", Email: "carol@mail.io"}, "password")
+		if err := roleService.AssignRole(goChat.NewContextWithUserId(ctx, bob.Id), carol.Id, goChat.RoleAdmin); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := s.PurgeDueAccounts(ctx); err != nil {
+			t.Fatal(err)
+		} else if n != 1 {
+			t.Fatalf("purged %d accounts, want 1", n)
+		}
+	})
+
+	// return ENotFound if user doesn't exist
+	t.Run("user doesn't exist", func(t *testing.T) {
+		_, err := s.RequestDeletion(ctx, -1)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package sqlite
+
+import (
+	"context"
+	"strings"
+
+	"github.com/adamni21/goChat"
+)
+
+const auditLogServiceOp = "sqlite.AuditLogService."
+
+// AuditLogService represents a service for reading the audit log.
+type AuditLogService struct {
+	db *DB
+}
+
+// returns new instance of AuditLogService
+func NewAuditLogService(db *DB) *AuditLogService {
+	return &AuditLogService{db: db}
+}
+
+// Retrieves audit entries matching filter, most recent first.
+// Requires PermViewAuditLog.
+func (s *AuditLogService) FindAuditEntries(ctx context.Context, filter goChat.AuditFilter) ([]*goChat.AuditEntry, error) {
+	const op = auditLogServiceOp + "FindAuditEntries"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	if err = authorize(ctx, tx, op); err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+
+	where, args := []string{"1 = 1"}, []any{}
+	if v := filter.ActorId; v != 0 {
+		where, args = append(where, "actorId = ?"), append(args, v)
+	}
+	if v := filter.TargetUserId; v != 0 {
+		where, args = append(where, "targetUserId = ?"), append(args, v)
+	}
+	if v := filter.Action; v != "" {
+		where, args = append(where, "action = ?"), append(args, v)
+	}
+	if v := filter.BeforeId; v != 0 {
+		where, args = append(where, "id < ?"), append(args, v)
+	}
+
+	query := `
+		SELECT id, actorId, action, targetUserId, detail, createdAt FROM audit_log
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY id DESC
+	`
+	if filter.Limit > 0 {
+		query += "LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, goChat.NewInternalErr("querying audit_log", op, "", err)
+	}
+	defer rows.Close()
+
+	entries := make([]*goChat.AuditEntry, 0)
+	for rows.Next() {
+		entry := &goChat.AuditEntry{}
+		err := rows.Scan(&entry.Id, &entry.ActorId, &entry.Action, &entry.TargetUserId, &entry.Detail, (*NullTime)(&entry.CreatedAt))
+		if err != nil {
+			return nil, goChat.NewInternalErr("scanning row", op, "", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, goChat.NewInternalErr("iterating rows", op, "", err)
+	}
+
+	return entries, nil
+}
+
+// Records an action of the user in ctx, see goChat.UserIdFromContext,
+// as part of tx so it is only logged if the action commits.
+func insertAuditEntry(ctx context.Context, tx *Tx, action string, targetUserId goChat.Id, detail string) error {
+	const op = "insertAuditEntry"
+
+	query := `
+		INSERT INTO audit_log (actorId, action, targetUserId, detail, createdAt)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	_, err := tx.ExecContext(ctx, query, goChat.UserIdFromContext(ctx), action, targetUserId, detail, (*NullTime)(&tx.now))
+	if err != nil {
+		return goChat.NewInternalErr("inserting into audit_log table", op, "", err)
+	}
+	return nil
+}
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/adamni21/goChat"
@@ -17,22 +19,53 @@ const authServiceOp = "sqlite.AuthService."
 type AuthService struct {
 	db       *DB
 	pwHasher crypto.PasswordHasher
+
+	dummyOnce sync.Once
+	dummy     string
+	dummyErr  error
+
+	// Refuse to log in users that haven't verified their email address.
+	RequireVerifiedEmail bool
+
+	// Absolute lifetime of sessions, RememberMeLifetime applies if the
+	// user asked to be remembered at login.
+	SessionLifetime    time.Duration
+	RememberMeLifetime time.Duration
+	// Sessions unused for IdleTimeout expire early, 0 disables it.
+	IdleTimeout time.Duration
+	// Min time between two renewals of the same session, so not every
+	// request writes to the database.
+	RenewInterval time.Duration
+
+	// Max number of sessions deleted per transaction by PruneSessions.
+	// Values <= 0 use defaultPruneBatchSize.
+	PruneBatchSize int
 }
 
+const defaultPruneBatchSize = 1000
+
 // returns new instance of AuthService
 func NewAuthService(db *DB) *AuthService {
 	return &AuthService{
-		db:       db,
-		pwHasher: crypto.NewArgon2Hasher(),
+		db:                 db,
+		pwHasher:           crypto.NewArgon2Hasher(),
+		SessionLifetime:    24 * time.Hour,
+		RememberMeLifetime: 30 * 24 * time.Hour,
+		IdleTimeout:        7 * 24 * time.Hour,
+		RenewInterval:      5 * time.Minute,
+		PruneBatchSize:     defaultPruneBatchSize,
 	}
 }
 
 // Verifies user and creates new session for specified user.
-// Returns id of created session.
+// Returns id of created session. rememberMe picks RememberMeLifetime
+// instead of SessionLifetime.
 //
 // Returns ENotFound if user doesn't exist.
-// Returns EUnauthorized if credentials are invalid.
-func (s *AuthService) Login(ctx context.Context, user goChat.User, password string) (goChat.Session, error) {
+// Returns EUnauthorized if credentials are invalid or RequireVerifiedEmail
+// is set and the user hasn't verified the email address.
+// Returns ESuspended if the user is suspended.
+func (s *AuthService) Login(ctx context.Context, user goChat.User, password string, rememberMe bool) (goChat.Session, error) {
 	const op = authServiceOp + "Login"
 	correct, err := s.VerifyUser(ctx, user, password)
 	if err != nil {
@@ -42,13 +75,91 @@ func (s *AuthService) Login(ctx context.Context, user goChat.User, password stri
 		return goChat.Session{}, goChat.NewUnauthorizedErr("", op, "Wrong password.", nil)
 	}
 
-	tx, err := s.db.BeginTx(ctx, nil)
+	session, err := s.startSession(ctx, user.Id, rememberMe)
 	if err != nil {
 		return goChat.Session{}, goChat.Error{Op: op, Err: err}
 	}
+	return session, nil
+}
+
+// Looks the user up by credentials.Login, which may be a username or an
+// email address, and creates a new session if the password matches.
+// Unknown users still cost a password verification, so response times
+// don't reveal which accounts exist.
+//
+// Returns EUnauthorized with the same message for every failed login:
+// unknown users, wrong passwords, suspended users and, if
+// RequireVerifiedEmail is set, unverified email addresses.
+func (s *AuthService) LoginWithCredentials(ctx context.Context, credentials goChat.Credentials) (goChat.Session, error) {
+	const op = authServiceOp + "LoginWithCredentials"
+	invalidErr := goChat.NewUnauthorizedErr("", op, "Invalid login or password.", nil)
+
+	// fetched before the lookup, so generating it on first use doesn't only
+	// slow down logins of unknown users
+	dummyDigest, err := s.dummyDigest()
+	if err != nil {
+		return goChat.Session{}, goChat.Error{Op: op, Err: err}
+	}
+
+	userId, passwordDigest, err := s.findCredentials(ctx, credentials.Login)
+	if val, ok := err.(goChat.Error); ok && val.ErrCode() == goChat.ENotFound {
+		// burn the same time as a real verification
+		if _, err := s.pwHasher.Verify(credentials.Password, dummyDigest); err != nil {
+			return goChat.Session{}, goChat.NewInternalErr("verifying dummy digest", op, "", err)
+		}
+		return goChat.Session{}, invalidErr
+	} else if err != nil {
+		return goChat.Session{}, goChat.Error{Op: op, Err: err}
+	}
+
+	correct, err := s.pwHasher.Verify(credentials.Password, passwordDigest)
+	if err != nil {
+		return goChat.Session{}, goChat.NewInternalErr("verifying password", op, "", err)
+	}
+	if !correct {
+		return goChat.Session{}, invalidErr
+	}
+
+	session, err := s.startSession(ctx, userId, credentials.RememberMe)
+	if val, ok := err.(goChat.Error); ok && (val.ErrCode() == goChat.EUnauthorized || val.ErrCode() == goChat.ESuspended) {
+		// a distinct error would confirm the password to whoever guessed it
+		return goChat.Session{}, invalidErr
+	} else if err != nil {
+		return goChat.Session{}, goChat.Error{Op: op, Err: err}
+	}
+	return session, nil
+}
+
+// Creates a session for an authenticated user after checking that the
+// user may log in.
+func (s *AuthService) startSession(ctx context.Context, userId goChat.Id, rememberMe bool) (goChat.Session, error) {
+	const op = "startSession"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.Session{}, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
 	defer tx.Rollback()
 
-	session, err := createSession(ctx, tx, user.Id)
+	if s.RequireVerifiedEmail {
+		u, err := findUserBy(ctx, tx, "id", userId)
+		if err != nil {
+			return goChat.Session{}, goChat.Error{Op: op, Err: err}
+		}
+		if !u.Verified {
+			return goChat.Session{}, goChat.NewUnauthorizedErr("", op, "Email address not verified.", nil)
+		}
+	}
+
+	if err = checkNotSuspended(ctx, tx, userId); err != nil {
+		return goChat.Session{}, goChat.Error{Op: op, Err: err}
+	}
+
+	lifetime := s.SessionLifetime
+	if rememberMe {
+		lifetime = s.RememberMeLifetime
+	}
+	session, err := createSession(ctx, tx, userId, lifetime, s.IdleTimeout)
 	if err != nil {
 		return goChat.Session{}, goChat.Error{Op: op, Err: err}
 	}
@@ -60,6 +171,58 @@ func (s *AuthService) Login(ctx context.Context, user goChat.User, password stri
 	return session, nil
 }
 
+// Retrieves the id and password digest of the user identified by login,
+// an email address if it contains "@" and a username otherwise.
+//
+// Returns ENotFound if user doesn't exist.
+func (s *AuthService) findCredentials(ctx context.Context, login string) (goChat.Id, string, error) {
+	const op = "findCredentials"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, "", goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	var user *goChat.User
+	if strings.Contains(login, "@") {
+		if normalized, err := goChat.NormalizeEmail(login); err == nil {
+			login = normalized
+		}
+		user, err = findUserBy(ctx, tx, "email", login)
+	} else {
+		user, err = findUserByUsername(ctx, tx, login)
+	}
+	var userId goChat.Id
+	if err == nil {
+		userId = user.Id
+	} else if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+		return 0, "", goChat.Error{Op: op, Err: err}
+	}
+
+	// unknown users run the same query, so the database work doesn't tell them apart
+	var passwordDigest string
+	digestErr := tx.QueryRowContext(ctx, "SELECT passwordString FROM users WHERE id = ?", userId).Scan(&passwordDigest)
+	if user == nil {
+		return 0, "", goChat.Error{Op: op, Err: err}
+	} else if digestErr != nil {
+		return 0, "", goChat.NewInternalErr("querying password digest", op, "", digestErr)
+	}
+	return userId, passwordDigest, nil
+}
+
+// Returns a digest to verify against when the user is unknown. It is
+// generated on first use, so it matches the parameters of pwHasher.
+func (s *AuthService) dummyDigest() (string, error) {
+	s.dummyOnce.Do(func() {
+		s.dummy, s.dummyErr = s.pwHasher.Generate("")
+	})
+	if s.dummyErr != nil {
+		return "", goChat.NewInternalErr("generating dummy digest", "dummyDigest", "", s.dummyErr)
+	}
+	return s.dummy, nil
+}
+
 // Deletes specified session.
 func (s *AuthService) DeleteSession(ctx context.Context, sessionId goChat.SessionId) error {
 	const op = authServiceOp + "DeleteSession"
@@ -69,7 +232,7 @@ func (s *AuthService) DeleteSession(ctx context.Context, sessionId goChat.Sessio
 	}
 	defer tx.Rollback()
 
-	_, err = tx.Exec("DELETE FROM sessions WHERE id = ?;", sessionId)
+	_, err = tx.Exec("DELETE FROM sessions WHERE tokenHash = ?;", crypto.HashToken(string(sessionId)))
 	if err != nil {
 		return goChat.NewInternalErr("deleting session from DB", op, "", err)
 	}
@@ -80,31 +243,133 @@ func (s *AuthService) DeleteSession(ctx context.Context, sessionId goChat.Sessio
 	return nil
 }
 
-// Retrieves a single session by sessionId.
+// Retrieves a single session by sessionId. Unless the session was renewed
+// within RenewInterval its expiry is moved to IdleTimeout from now, capped
+// at MaxExpiry. Sessions created before renewal existed have no renewedAt
+// and keep their fixed expiry.
 //
-// Returns ENotFound error if specified sessionId doesn't exist.
+// Returns ENotFound error if specified sessionId doesn't exist or has expired.
+// Returns ESuspended if the session's user is suspended.
 func (s *AuthService) FindSession(ctx context.Context, sessionId goChat.SessionId) (*goChat.Session, error) {
 	const op = authServiceOp + "FindSession"
-	session := &goChat.Session{}
+	session := &goChat.Session{Id: sessionId}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
 
+	var renewedAt time.Time
 	query := `
-		SELECT id, userId, expiry FROM sessions
-		WHERE id = ?;
+		SELECT userId, expiry, maxExpiry, renewedAt FROM sessions
+		WHERE tokenHash = ?;
 	`
-	row := s.db.db.QueryRowContext(ctx, query, sessionId)
-	err := row.Scan(&session.Id, &session.UserId, (*NullTime)(&session.Expiry))
+	// only the hash may end up in logs, the token itself is a credential
+	tokenHash := crypto.HashToken(string(sessionId))
+	row := tx.QueryRowContext(ctx, query, tokenHash)
+	err = row.Scan(&session.UserId, (*NullTime)(&session.Expiry), (*NullTime)(&session.MaxExpiry), (*NullTime)(&renewedAt))
 	if err != nil {
-		info := fmt.Sprintf("sessionId: %s", sessionId)
+		info := fmt.Sprintf("tokenHash: %s", tokenHash)
 		if err == sql.ErrNoRows {
 			return nil, goChat.NewNotFoundErr(info, op, "", nil)
 		}
 
 		return nil, goChat.NewInternalErr(info, op, "", err)
 	}
+	if !tx.now.Before(session.Expiry) {
+		info := fmt.Sprintf("tokenHash: %s, expired: %s", tokenHash, session.Expiry)
+		return nil, goChat.NewNotFoundErr(info, op, "Session expired.", nil)
+	}
+
+	if err = checkNotSuspended(ctx, tx, session.UserId); err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+
+	// renewing a migrated session would cut its expiry to IdleTimeout
+	if s.IdleTimeout > 0 && !renewedAt.IsZero() && tx.now.Sub(renewedAt) >= s.RenewInterval {
+		if err = renewSession(ctx, tx, session, s.IdleTimeout); err != nil {
+			return nil, goChat.Error{Op: op, Err: err}
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, goChat.NewInternalErr("committing transaction", op, "", err)
+		}
+	}
 
 	return session, nil
 }
 
+// Deletes expired sessions in batches of PruneBatchSize, so writers aren't
+// blocked for long. Returns the number of sessions deleted.
+func (s *AuthService) PruneSessions(ctx context.Context) (int, error) {
+	const op = authServiceOp + "PruneSessions"
+
+	// LIMIT 0 would delete nothing and LIMIT -1 everything at once
+	batchSize := s.PruneBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultPruneBatchSize
+	}
+
+	total := 0
+	for {
+		n, err := s.pruneSessionsBatch(ctx, batchSize)
+		total += n
+		if err != nil {
+			return total, goChat.Error{Op: op, Err: err}
+		}
+		if n < batchSize {
+			return total, nil
+		}
+	}
+}
+
+// Calls PruneSessions every interval until ctx is done.
+// The result of every run is passed to report, which may be nil.
+func (s *AuthService) RunSessionPruner(ctx context.Context, interval time.Duration, report func(n int, err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.PruneSessions(ctx)
+			if report != nil {
+				report(n, err)
+			}
+		}
+	}
+}
+
+func (s *AuthService) pruneSessionsBatch(ctx context.Context, batchSize int) (int, error) {
+	const op = "pruneSessionsBatch"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM sessions
+		WHERE rowid IN (SELECT rowid FROM sessions WHERE expiry <= ? LIMIT ?)
+	`
+	result, err := tx.ExecContext(ctx, query, (*NullTime)(&tx.now), batchSize)
+	if err != nil {
+		return 0, goChat.NewInternalErr("deleting expired sessions", op, "", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, goChat.NewInternalErr("getting rows affected", op, "", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return int(n), nil
+}
+
 // Returns bool whether password is correct.
 //
 // Returns ENotFound if user doesn't exist.
@@ -122,29 +387,112 @@ func (s *AuthService) VerifyUser(ctx context.Context, user goChat.User, password
 	return isCorrect, nil
 }
 
-func createSession(ctx context.Context, tx *Tx, userId goChat.Id) (goChat.Session, error) {
+// Verifies change.OldPassword and replaces it with change.NewPassword.
+//
+// Returns ENotFound if user doesn't exist.
+// Returns EUnauthorized if change.OldPassword is invalid.
+// Returns EInvalid if change.NewPassword violates the password policy.
+func (s *AuthService) ChangePassword(ctx context.Context, user goChat.User, change goChat.PasswordChange) error {
+	const op = authServiceOp + "ChangePassword"
+	correct, err := s.VerifyUser(ctx, user, change.OldPassword)
+	if err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+	if !correct {
+		return goChat.NewUnauthorizedErr("", op, "Wrong password.", nil)
+	}
+
+	if err := goChat.ValidatePassword(change.NewPassword); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+	passwordDigest, err := s.pwHasher.Generate(change.NewPassword)
+	if err != nil {
+		return goChat.NewInternalErr("generating password hash", op, "", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	if err = updatePasswordDigest(ctx, tx, user.Id, passwordDigest); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+	if change.RevokeOtherSessions {
+		if err = deleteUserSessions(ctx, tx, user.Id, change.CurrentSession); err != nil {
+			return goChat.Error{Op: op, Err: err}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
+
+// Creates a session ending after lifetime, or earlier if it isn't used
+// for idleTimeout. A zero idleTimeout disables the idle timeout.
+func createSession(ctx context.Context, tx *Tx, userId goChat.Id, lifetime, idleTimeout time.Duration) (goChat.Session, error) {
 	const op = "createSession"
 	sessionId, err := crypto.GenerateRandomBytes(16)
 	if err != nil {
 		return goChat.Session{}, goChat.NewInternalErr("generate random bytes", op, "", err)
 	}
 
-	b64SessionId := base64.URLEncoding.EncodeToString(sessionId)
-	expiry := tx.now.Add(30 * 24 * time.Hour).Truncate(time.Second)
+	session := goChat.Session{
+		Id:        goChat.SessionId(base64.URLEncoding.EncodeToString(sessionId)),
+		UserId:    userId,
+		MaxExpiry: tx.now.Add(lifetime).Truncate(time.Second),
+	}
+	session.Expiry = idleExpiry(tx.now, session.MaxExpiry, idleTimeout)
+
 	query := `
-		INSERT INTO sessions (id, userId, expiry)
-		VALUES (?, ?, ?)
+		INSERT INTO sessions (tokenHash, userId, expiry, maxExpiry, renewedAt)
+		VALUES (?, ?, ?, ?, ?)
 	`
-	_, err = tx.Exec(query, b64SessionId, userId, (*NullTime)(&expiry))
+	_, err = tx.ExecContext(ctx, query, crypto.HashToken(string(session.Id)), userId, (*NullTime)(&session.Expiry), (*NullTime)(&session.MaxExpiry), (*NullTime)(&tx.now))
 	if err != nil {
 		return goChat.Session{}, goChat.NewInternalErr("inserting into sessions table", op, "", err)
 	}
 
-	return goChat.Session{
-		Id:     goChat.SessionId(b64SessionId),
-		UserId: userId,
-		Expiry: expiry,
-	}, nil
+	return session, nil
+}
+
+// Moves the expiry of session to idleTimeout from now, capped at its MaxExpiry.
+func renewSession(ctx context.Context, tx *Tx, session *goChat.Session, idleTimeout time.Duration) error {
+	const op = "renewSession"
+	session.Expiry = idleExpiry(tx.now, session.MaxExpiry, idleTimeout)
+
+	query := `
+		UPDATE sessions
+		SET expiry = ?, renewedAt = ?
+		WHERE tokenHash = ?
+	`
+	_, err := tx.ExecContext(ctx, query, (*NullTime)(&session.Expiry), (*NullTime)(&tx.now), crypto.HashToken(string(session.Id)))
+	if err != nil {
+		return goChat.NewInternalErr("updating sessions table", op, "", err)
+	}
+	return nil
+}
+
+func idleExpiry(now, maxExpiry time.Time, idleTimeout time.Duration) time.Time {
+	if expiry := now.Add(idleTimeout).Truncate(time.Second); idleTimeout > 0 && expiry.Before(maxExpiry) {
+		return expiry
+	}
+	return maxExpiry
+}
+
+// Deletes all sessions of the specified user except keep.
+// Pass an empty keep to delete every session.
+func deleteUserSessions(ctx context.Context, tx *Tx, userId goChat.Id, keep goChat.SessionId) error {
+	const op = "deleteUserSessions"
+	_, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE userId = ? AND tokenHash != ?", userId, crypto.HashToken(string(keep)))
+	if err != nil {
+		return goChat.NewInternalErr("deleting sessions of user", op, "", err)
+	}
+	return nil
 }
 
 // Retrieves password digest from DB for specified user.
@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/adamni21/goChat"
+)
+
+// countingHasher counts hashes and fails verification if verifyErr is set.
+type countingHasher struct {
+	generated int
+	verified  int
+	verifyErr error
+}
+
+func (h *countingHasher) Generate(password string) (string, error) {
+	h.generated++
+	return "digest:" + password, nil
+}
+
+func (h *countingHasher) Verify(password, hash string) (bool, error) {
+	h.verified++
+	return hash == "digest:"+password, h.verifyErr
+}
+
+// unknown and known users cost the same hashing, even on the first login
+func TestLoginWithCredentialsHashing(t *testing.T) {
+	db := NewDB(":memory:")
+	if err := db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	user := &goChat.User{Username: "user0", Email: "test@mail.io"}
+	if err := NewUserService(db).Create(ctx, user, "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, login := range []string{"unknown", "user0"} {
+		t.Run("first login "+login, func(t *testing.T) {
+			hasher := &countingHasher{}
+			s := NewAuthService(db)
+			s.pwHasher = hasher
+			if _, err := s.LoginWithCredentials(ctx, goChat.Credentials{Login: login, Password: "wrong"}); err == nil {
+				t.Fatal("expected an error")
+			}
+			if hasher.generated != 1 || hasher.verified != 1 {
+				t.Fatalf("generated %d verified %d, want 1 and 1", hasher.generated, hasher.verified)
+			}
+		})
+	}
+
+	// a failing verification isn't reported as wrong credentials
+	t.Run("verify fails", func(t *testing.T) {
+		s := NewAuthService(db)
+		s.pwHasher = &countingHasher{verifyErr: errors.New("verify failed")}
+		_, err := s.LoginWithCredentials(ctx, goChat.Credentials{Login: "unknown", Password: "wrong"})
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EInternal {
+			t.Fatalf("expected EInternal got %+v", err)
+		}
+	})
+}
@@ -3,7 +3,11 @@ package sqlite_test
 import (
 	"context"
 	"encoding/base64"
+	"fmt"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -26,7 +30,7 @@ func TestLogin(t *testing.T) {
 
 	// can successfully login
 	t.Run("login successfully", func(t *testing.T) {
-		session, err := authService.Login(ctx, *user, password)
+		session, err := authService.Login(ctx, *user, password, false)
 		if err != nil {
 			t.Fatalf("expected no error got %+v", err)
 		}
@@ -53,7 +57,7 @@ func TestLogin(t *testing.T) {
 
 	// return EUnauthorized if password is not correct
 	t.Run("wrong password", func(t *testing.T) {
-		session, err := authService.Login(ctx, *user, "wrongPassword")
+		session, err := authService.Login(ctx, *user, "wrongPassword", false)
 		if err == nil {
 			t.Fatal("expected an error")
 		}
@@ -67,7 +71,7 @@ func TestLogin(t *testing.T) {
 
 	// return ENotFound if user not exists
 	t.Run("user doesn't exist", func(t *testing.T) {
-		session, err := authService.Login(ctx, goChat.User{Id: -1}, "wrongPassword")
+		session, err := authService.Login(ctx, goChat.User{Id: -1}, "wrongPassword", false)
 		if err == nil {
 			t.Fatal("expected an error")
 		}
@@ -80,6 +84,105 @@ func TestLogin(t *testing.T) {
 	})
 }
 
+func TestLoginWithCredentials(t *testing.T) {
+	authService, db, closeDB, ctx := InitAuthService(t)
+	defer closeDB()
+	user := MustCreateUser(t, ctx, sqlite.NewUserService(db), &goChat.User{Username: "user0", Email: "test@mail.io"}, "password")
+
+	// log in by username or email, ignoring case
+	for _, login := range []string{"User0", "Test@mail.io"} {
+		t.Run("login with "+login, func(t *testing.T) {
+			session, err := authService.LoginWithCredentials(ctx, goChat.Credentials{Login: login, Password: "password"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if session.UserId != user.Id {
+				t.Fatalf("userId incorrect, want %d got %d", user.Id, session.UserId)
+			}
+		})
+	}
+
+	// return the same EUnauthorized for unknown users and wrong passwords
+	t.Run("uniform error", func(t *testing.T) {
+		_, wrongPasswordErr := authService.LoginWithCredentials(ctx, goChat.Credentials{Login: "user0", Password: "wrongPassword"})
+		if val, ok := wrongPasswordErr.(goChat.Error); !ok || val.ErrCode() != goChat.EUnauthorized {
+			t.Fatalf("expected EUnauthorized got %+v", wrongPasswordErr)
+		}
+		for _, login := range []string{"user1", "unknown@mail.io", ""} {
+			_, err := authService.LoginWithCredentials(ctx, goChat.Credentials{Login: login, Password: "password"})
+			if !reflect.DeepEqual(err, wrongPasswordErr) {
+				t.Fatalf("login %q: got %+v, want %+v", login, err, wrongPasswordErr)
+			}
+		}
+
+		// the correct password of an account that can't log in isn't confirmed either
+		verifiedOnly := sqlite.NewAuthService(db)
+		verifiedOnly.RequireVerifiedEmail = true
+		_, err := verifiedOnly.LoginWithCredentials(ctx, goChat.Credentials{Login: "user0", Password: "password"})
+		if !reflect.DeepEqual(err, wrongPasswordErr) {
+			t.Fatalf("unverified: got %+v, want %+v", err, wrongPasswordErr)
+		}
+
+		admin := MustCreateUser(t, ctx, sqlite.NewUserService(db), &goChat.User{Username: "admin0", Email: "admin@mail.io"}, "password")
+		if err := sqlite.NewRoleService(db).GrantInitialAdmin(ctx, admin.Id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := sqlite.NewSuspensionService(db).Suspend(goChat.NewContextWithUserId(ctx, admin.Id), user.Id, "spam", 0); err != nil {
+			t.Fatal(err)
+		}
+		_, err = authService.LoginWithCredentials(ctx, goChat.Credentials{Login: "user0", Password: "password"})
+		if !reflect.DeepEqual(err, wrongPasswordErr) {
+			t.Fatalf("suspended: got %+v, want %+v", err, wrongPasswordErr)
+		}
+	})
+}
+
+// only a digest of the session id is stored
+func TestSessionIdHashed(t *testing.T) {
+	authService, db, closeDB, ctx := InitAuthService(t)
+	defer closeDB()
+	user := MustCreateUser(t, ctx, sqlite.NewUserService(db), &goChat.User{Username: "user0", Email: "test@mail.io"}, "password")
+
+	session, err := authService.Login(ctx, *user, "password", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	var tokenHash, sqlHash string
+	if err := tx.QueryRowContext(ctx, "SELECT tokenHash FROM sessions WHERE userId = ?", user.Id).Scan(&tokenHash); err != nil {
+		t.Fatal(err)
+	}
+	if want := crypto.HashToken(string(session.Id)); tokenHash != want {
+		t.Fatalf("stored %q, want digest %q", tokenHash, want)
+	}
+
+	// used by the migration hashing existing sessions
+	if err := tx.QueryRowContext(ctx, "SELECT hash_token(?)", session.Id).Scan(&sqlHash); err != nil {
+		t.Fatal(err)
+	}
+	if sqlHash != tokenHash {
+		t.Fatalf("hash_token returned %q, want %q", sqlHash, tokenHash)
+	}
+	tx.Rollback()
+
+	// failed lookups don't put the token into the error
+	db.Now = func() time.Time { return session.Expiry }
+	for _, id := range []goChat.SessionId{"unknownToken", session.Id} {
+		_, err := authService.FindSession(ctx, id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		} else if strings.Contains(val.Info, string(id)) {
+			t.Fatalf("info %q contains the token", val.Info)
+		}
+	}
+}
+
 // successfully delete a session
 func TestDeleteSession(t *testing.T) {
 	authService, db, closeDB, ctx := InitAuthService(t)
@@ -109,7 +212,7 @@ func TestFindSession(t *testing.T) {
 	userService := sqlite.NewUserService(db)
 	defer closeDB()
 
-	user := MustCreateUser(t, ctx, userService, &goChat.User{}, "")
+	user := MustCreateUser(t, ctx, userService, &goChat.User{Username: "user0", Email: "test@mail.io"}, "")
 	session := goChat.Session{UserId: user.Id}
 	MustCreateSession(t, ctx, db, &session)
 	t.Run("find session successfully", func(t *testing.T) {
@@ -134,6 +237,173 @@ func TestFindSession(t *testing.T) {
 			t.Fatalf("expected err code %v got %v", goChat.ENotFound, goChatErr.ErrCode())
 		}
 	})
+
+	// return ENotFound once the session has expired
+	t.Run("session expired", func(t *testing.T) {
+		db.Now = func() time.Time { return session.Expiry }
+		defer func() { db.Now = func() time.Time { return time.Now().UTC() } }()
+
+		_, err := authService.FindSession(ctx, session.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		}
+	})
+}
+
+func TestSessionRenewal(t *testing.T) {
+	db := MustOpenDB(t)
+	defer MustCloseDB(t, db)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	db.Now = func() time.Time { return now }
+
+	authService := sqlite.NewAuthService(db)
+	authService.SessionLifetime = 2 * time.Hour
+	authService.RememberMeLifetime = 48 * time.Hour
+	authService.IdleTimeout = time.Hour
+	authService.RenewInterval = 10 * time.Minute
+	user := MustCreateUser(t, ctx, sqlite.NewUserService(db), &goChat.User{Username: "user0", Email: "test@mail.io"}, "password")
+
+	findSession := func(t *testing.T, id goChat.SessionId) *goChat.Session {
+		t.Helper()
+		session, err := authService.FindSession(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return session
+	}
+
+	t.Run("remember me", func(t *testing.T) {
+		session, err := authService.Login(ctx, *user, "password", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := now.Add(48 * time.Hour); !session.MaxExpiry.Equal(want) {
+			t.Fatalf("MaxExpiry=%s, want %s", session.MaxExpiry, want)
+		}
+		if want := now.Add(time.Hour); !session.Expiry.Equal(want) {
+			t.Fatalf("Expiry=%s, want %s", session.Expiry, want)
+		}
+	})
+
+	t.Run("sliding renewal", func(t *testing.T) {
+		start := now
+		defer func() { now = start }()
+
+		session, err := authService.Login(ctx, *user, "password", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// renewals within RenewInterval are skipped
+		now = start.Add(5 * time.Minute)
+		if got := findSession(t, session.Id); !got.Expiry.Equal(session.Expiry) {
+			t.Fatalf("Expiry=%s, want unchanged %s", got.Expiry, session.Expiry)
+		}
+
+		now = start.Add(30 * time.Minute)
+		if got, want := findSession(t, session.Id).Expiry, now.Add(time.Hour); !got.Equal(want) {
+			t.Fatalf("Expiry=%s, want %s", got, want)
+		}
+
+		// capped at MaxExpiry
+		now = start.Add(80 * time.Minute)
+		if got := findSession(t, session.Id).Expiry; !got.Equal(session.MaxExpiry) {
+			t.Fatalf("Expiry=%s, want %s", got, session.MaxExpiry)
+		}
+
+		now = session.MaxExpiry
+		_, err = authService.FindSession(ctx, session.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		}
+	})
+
+	// sessions from before renewal existed have no renewedAt
+	t.Run("migrated session keeps expiry", func(t *testing.T) {
+		session := &goChat.Session{UserId: user.Id}
+		MustCreateSession(t, ctx, db, session)
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec("UPDATE sessions SET renewedAt = NULL WHERE tokenHash = ?", crypto.HashToken(string(session.Id))); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := findSession(t, session.Id); !got.Expiry.Equal(session.Expiry) {
+			t.Fatalf("Expiry=%s, want unchanged %s", got.Expiry, session.Expiry)
+		}
+	})
+
+	t.Run("idle timeout", func(t *testing.T) {
+		start := now
+		defer func() { now = start }()
+
+		session, err := authService.Login(ctx, *user, "password", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		now = start.Add(time.Hour)
+		_, err = authService.FindSession(ctx, session.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		}
+	})
+}
+
+func TestPruneSessions(t *testing.T) {
+	db := MustOpenDB(t)
+	defer MustCloseDB(t, db)
+	ctx := context.Background()
+
+	authService := sqlite.NewAuthService(db)
+	authService.PruneBatchSize = 2
+	user := MustCreateUser(t, ctx, sqlite.NewUserService(db), &goChat.User{Username: "user0", Email: "test@mail.io"}, "")
+	sessions := make([]*goChat.Session, 5)
+	for i := range sessions {
+		sessions[i] = &goChat.Session{UserId: user.Id}
+		MustCreateSession(t, ctx, db, sessions[i])
+	}
+
+	if n, err := authService.PruneSessions(ctx); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("pruned %d sessions before any expired", n)
+	}
+
+	db.Now = func() time.Time { return sessions[len(sessions)-1].Expiry }
+	if n, err := authService.PruneSessions(ctx); err != nil {
+		t.Fatal(err)
+	} else if n != len(sessions) {
+		t.Fatalf("pruned %d sessions, want %d", n, len(sessions))
+	}
+
+	// batch sizes <= 0 fall back to the default instead of looping forever
+	for _, size := range []int{0, -1} {
+		t.Run(fmt.Sprintf("batch size %d", size), func(t *testing.T) {
+			authService.PruneBatchSize = size
+			for i := range sessions {
+				sessions[i] = &goChat.Session{UserId: user.Id}
+				MustCreateSession(t, ctx, db, sessions[i])
+			}
+			db.Now = func() time.Time { return sessions[len(sessions)-1].Expiry }
+
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			if n, err := authService.PruneSessions(ctx); err != nil {
+				t.Fatal(err)
+			} else if n != len(sessions) {
+				t.Fatalf("pruned %d sessions, want %d", n, len(sessions))
+			}
+		})
+	}
 }
 
 func TestVerifyUser(t *testing.T) {
@@ -183,6 +453,57 @@ func TestVerifyUser(t *testing.T) {
 	})
 }
 
+func TestChangePassword(t *testing.T) {
+	authService, db, closeDB, ctx := InitAuthService(t)
+	userService := sqlite.NewUserService(db)
+	defer closeDB()
+
+	user := MustCreateUser(t, ctx, userService, &goChat.User{Username: "user0", Email: "test@mail.io"}, "password")
+	current := &goChat.Session{UserId: user.Id}
+	MustCreateSession(t, ctx, db, current)
+	other := &goChat.Session{UserId: user.Id}
+	MustCreateSession(t, ctx, db, other)
+
+	// return EUnauthorized if old password is wrong
+	t.Run("wrong old password", func(t *testing.T) {
+		err := authService.ChangePassword(ctx, *user, goChat.PasswordChange{OldPassword: "wrong", NewPassword: "newPassword"})
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EUnauthorized {
+			t.Fatalf("expected EUnauthorized got %+v", err)
+		}
+	})
+
+	// return EInvalid if new password violates policy
+	t.Run("new password too short", func(t *testing.T) {
+		err := authService.ChangePassword(ctx, *user, goChat.PasswordChange{OldPassword: "password", NewPassword: "short"})
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EInvalid {
+			t.Fatalf("expected EInvalid got %+v", err)
+		}
+	})
+
+	t.Run("change and revoke other sessions", func(t *testing.T) {
+		err := authService.ChangePassword(ctx, *user, goChat.PasswordChange{
+			OldPassword:         "password",
+			NewPassword:         "newPassword",
+			RevokeOtherSessions: true,
+			CurrentSession:      current.Id,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok, err := authService.VerifyUser(ctx, *user, "newPassword"); err != nil || !ok {
+			t.Fatalf("expected new password to be valid, got %t %+v", ok, err)
+		}
+		if _, err := authService.FindSession(ctx, current.Id); err != nil {
+			t.Fatalf("expected current session to be kept got %+v", err)
+		}
+		_, err = authService.FindSession(ctx, other.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected other session to be revoked got %+v", err)
+		}
+	})
+}
+
 func MustCreateSession(tb testing.TB, ctx context.Context, db *sqlite.DB, session *goChat.Session) {
 	tb.Helper()
 	sessionId, err := crypto.GenerateRandomBytes(16)
@@ -191,7 +512,9 @@ func MustCreateSession(tb testing.TB, ctx context.Context, db *sqlite.DB, sessio
 	}
 
 	session.Id = goChat.SessionId(base64.URLEncoding.EncodeToString(sessionId))
-	session.Expiry = time.Now().UTC().Add(30 * 24 * time.Hour).Truncate(time.Second)
+	now := time.Now().UTC()
+	session.Expiry = now.Add(30 * 24 * time.Hour).Truncate(time.Second)
+	session.MaxExpiry = session.Expiry
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		tb.Fatal(err)
@@ -199,10 +522,10 @@ func MustCreateSession(tb testing.TB, ctx context.Context, db *sqlite.DB, sessio
 	defer tx.Rollback()
 
 	query := `
-		INSERT INTO sessions (id, userId, expiry)
-		VALUES (?, ?, ?)
+		INSERT INTO sessions (tokenHash, userId, expiry, maxExpiry, renewedAt)
+		VALUES (?, ?, ?, ?, ?)
 	`
-	_, err = tx.Exec(query, session.Id, session.UserId, (*sqlite.NullTime)(&session.Expiry))
+	_, err = tx.Exec(query, crypto.HashToken(string(session.Id)), session.UserId, (*sqlite.NullTime)(&session.Expiry), (*sqlite.NullTime)(&session.MaxExpiry), (*sqlite.NullTime)(&now))
 	if err != nil {
 		tb.Fatal(err)
 	}
@@ -219,3 +542,68 @@ func InitAuthService(tb testing.TB) (goChat.AuthService, *sqlite.DB, func(), con
 	s := sqlite.NewAuthService(db)
 	return s, db, func() { MustCloseDB(tb, db) }, ctx
 }
+
+// looking up sessions only reads, so concurrent writers don't make it fail
+func TestFindSessionConcurrentWrites(t *testing.T) {
+	db := sqlite.NewDB(filepath.Join(t.TempDir(), "db"))
+	if err := db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer MustCloseDB(t, db)
+	ctx := context.Background()
+
+	authService := sqlite.NewAuthService(db)
+	userService := sqlite.NewUserService(db)
+	user := MustCreateUser(t, ctx, userService, &goChat.User{Username: "user0", Email: "test@mail.io"}, "password")
+	session := &goChat.Session{UserId: user.Id}
+	MustCreateSession(t, ctx, db, session)
+
+	done := make(chan struct{})
+	writerErr := make(chan error, 1)
+	go func() {
+		defer close(writerErr)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			bio := fmt.Sprintf("bio %d", i)
+			if _, err := userService.UpdateProfile(ctx, user.Id, goChat.ProfileUpdate{Bio: &bio}); err != nil {
+				writerErr <- err
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8*200)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				if _, err := authService.FindSession(ctx, session.Id); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	close(errs)
+
+	if err := <-writerErr; err != nil {
+		t.Fatal(err)
+	}
+	failed := 0
+	for err := range errs {
+		if failed == 0 {
+			t.Error(err)
+		}
+		failed++
+	}
+	if failed > 0 {
+		t.Fatalf("%d of %d lookups failed", failed, 8*200)
+	}
+}
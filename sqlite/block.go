@@ -0,0 +1,162 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/adamni21/goChat"
+	"github.com/mattn/go-sqlite3"
+)
+
+const blockServiceOp = "sqlite.BlockService."
+
+// BlockService represents a service for users blocking each other.
+type BlockService struct {
+	db *DB
+}
+
+// returns new instance of BlockService
+func NewBlockService(db *DB) *BlockService {
+	return &BlockService{db: db}
+}
+
+// Blocks blockedId for blockerId. Blocking an already blocked user does nothing.
+//
+// Returns ENotFound if either user doesn't exist.
+// Returns EInvalid if blockerId equals blockedId.
+func (s *BlockService) Block(ctx context.Context, blockerId, blockedId goChat.Id) error {
+	const op = blockServiceOp + "Block"
+	if blockerId == blockedId {
+		return goChat.NewInvalidErr("", op, "You can't block yourself.", nil)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO blocks (blockerId, blockedId, createdAt)
+		VALUES (?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`
+	_, err = tx.ExecContext(ctx, query, blockerId, blockedId, (*NullTime)(&tx.now))
+	if err != nil {
+		info := fmt.Sprintf("blockerId: %d, blockedId: %d", blockerId, blockedId)
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey {
+			return goChat.NewNotFoundErr(info, op, "User not found.", nil)
+		}
+		return goChat.NewInternalErr(info, op, "", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
+
+// Removes the block of blockedId by blockerId.
+//
+// Returns ENotFound if blockerId hasn't blocked blockedId.
+func (s *BlockService) Unblock(ctx context.Context, blockerId, blockedId goChat.Id) error {
+	const op = blockServiceOp + "Unblock"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM blocks WHERE blockerId = ? AND blockedId = ?", blockerId, blockedId)
+	if err != nil {
+		return goChat.NewInternalErr("deleting from blocks table", op, "", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return goChat.NewInternalErr("getting rows affected", op, "", err)
+	}
+	if n == 0 {
+		info := fmt.Sprintf("blockerId: %d, blockedId: %d", blockerId, blockedId)
+		return goChat.NewNotFoundErr(info, op, "User isn't blocked.", nil)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
+
+// Retrieves the blocks created by blockerId, most recent first.
+func (s *BlockService) FindBlocks(ctx context.Context, blockerId goChat.Id) ([]*goChat.Block, error) {
+	const op = blockServiceOp + "FindBlocks"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT blockerId, blockedId, createdAt FROM blocks
+		WHERE blockerId = ?
+		ORDER BY createdAt DESC, blockedId
+	`
+	rows, err := tx.QueryContext(ctx, query, blockerId)
+	if err != nil {
+		return nil, goChat.NewInternalErr("querying blocks", op, "", err)
+	}
+	defer rows.Close()
+
+	blocks := make([]*goChat.Block, 0)
+	for rows.Next() {
+		block := &goChat.Block{}
+		if err := rows.Scan(&block.BlockerId, &block.BlockedId, (*NullTime)(&block.CreatedAt)); err != nil {
+			return nil, goChat.NewInternalErr("scanning row", op, "", err)
+		}
+		blocks = append(blocks, block)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, goChat.NewInternalErr("iterating rows", op, "", err)
+	}
+
+	return blocks, nil
+}
+
+// Returns true if either of the users has blocked the other.
+func (s *BlockService) IsBlocked(ctx context.Context, userId1, userId2 goChat.Id) (bool, error) {
+	const op = blockServiceOp + "IsBlocked"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	blocked, err := isBlocked(ctx, tx, userId1, userId2)
+	if err != nil {
+		return false, goChat.Error{Op: op, Err: err}
+	}
+	return blocked, nil
+}
+
+// Returns true if either of the users has blocked the other.
+// Used by other services to enforce blocks inside their transactions.
+func isBlocked(ctx context.Context, tx *Tx, userId1, userId2 goChat.Id) (bool, error) {
+	const op = "isBlocked"
+
+	var blocked bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM blocks
+			WHERE (blockerId = ? AND blockedId = ?) OR (blockerId = ? AND blockedId = ?)
+		)
+	`
+	err := tx.QueryRowContext(ctx, query, userId1, userId2, userId2, userId1).Scan(&blocked)
+	if err != nil {
+		return false, goChat.NewInternalErr("querying blocks", op, "", err)
+	}
+	return blocked, nil
+}
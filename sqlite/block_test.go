@@ -0,0 +1,75 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adamni21/goChat"
+	"github.com/adamni21/goChat/sqlite"
+)
+
+func TestBlock(t *testing.T) {
+	db := MustOpenDB(t)
+	defer MustCloseDB(t, db)
+	ctx := context.Background()
+
+	s := sqlite.NewBlockService(db)
+	userService := sqlite.NewUserService(db)
+	alice := MustCreateUser(t, ctx, userService, &goChat.User{Username: "alice", Email: "alice@mail.io"}, "password")
+	bob := MustCreateUser(t, ctx, userService, &goChat.User{Username: "bob", Email: "bob@mail.io"}, "password")
+
+	t.Run("block successfully", func(t *testing.T) {
+		if err := s.Block(ctx, alice.Id, bob.Id); err != nil {
+			t.Fatal(err)
+		}
+		// blocking twice does nothing
+		if err := s.Block(ctx, alice.Id, bob.Id); err != nil {
+			t.Fatal(err)
+		}
+
+		blocks, err := s.FindBlocks(ctx, alice.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(blocks) != 1 || blocks[0].BlockedId != bob.Id {
+			t.Fatalf("blocks=%+v, want block of %d", blocks, bob.Id)
+		}
+
+		// blocks apply in both directions
+		for _, ids := range [][2]goChat.Id{{alice.Id, bob.Id}, {bob.Id, alice.Id}} {
+			if blocked, err := s.IsBlocked(ctx, ids[0], ids[1]); err != nil || !blocked {
+				t.Fatalf("IsBlocked(%d, %d)=%t %v, want true", ids[0], ids[1], blocked, err)
+			}
+		}
+	})
+
+	// return EInvalid if user blocks themselves
+	t.Run("block self", func(t *testing.T) {
+		err := s.Block(ctx, alice.Id, alice.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EInvalid {
+			t.Fatalf("expected EInvalid got %+v", err)
+		}
+	})
+
+	// return ENotFound if blocked user doesn't exist
+	t.Run("user doesn't exist", func(t *testing.T) {
+		err := s.Block(ctx, alice.Id, -1)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		}
+	})
+
+	t.Run("unblock", func(t *testing.T) {
+		if err := s.Unblock(ctx, alice.Id, bob.Id); err != nil {
+			t.Fatal(err)
+		}
+		if blocked, err := s.IsBlocked(ctx, alice.Id, bob.Id); err != nil || blocked {
+			t.Fatalf("IsBlocked=%t %v, want false", blocked, err)
+		}
+
+		err := s.Unblock(ctx, alice.Id, bob.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		}
+	})
+}
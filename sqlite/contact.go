@@ -0,0 +1,452 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/adamni21/goChat"
+	"github.com/mattn/go-sqlite3"
+)
+
+const contactServiceOp = "sqlite.ContactService."
+
+// ContactService represents a service for contact lists and friend requests.
+type ContactService struct {
+	db *DB
+}
+
+// returns new instance of ContactService
+func NewContactService(db *DB) *ContactService {
+	return &ContactService{db: db}
+}
+
+// Sends a contact request from senderId to recipientId.
+//
+// Returns ENotFound if recipient doesn't exist or either user blocked the other.
+// Returns EInvalid if senderId equals recipientId.
+// Returns EConflict if the users are contacts already or a request
+// between them is pending.
+func (s *ContactService) SendRequest(ctx context.Context, senderId, recipientId goChat.Id) (*goChat.ContactRequest, error) {
+	const op = contactServiceOp + "SendRequest"
+	if senderId == recipientId {
+		return nil, goChat.NewInvalidErr("", op, "You can't add yourself as a contact.", nil)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	info := fmt.Sprintf("senderId: %d, recipientId: %d", senderId, recipientId)
+	// a block looks like a missing user, so the sender can't tell they were blocked
+	if blocked, err := isBlocked(ctx, tx, senderId, recipientId); err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	} else if blocked {
+		return nil, goChat.NewNotFoundErr(info, op, "User not found.", nil)
+	}
+	if contact, err := isContact(ctx, tx, senderId, recipientId); err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	} else if contact {
+		return nil, goChat.NewConflictErr(info, op, "User is already a contact.", nil)
+	}
+
+	request := &goChat.ContactRequest{
+		SenderId:    senderId,
+		RecipientId: recipientId,
+		State:       goChat.ContactRequestPending,
+		CreatedAt:   tx.now,
+		UpdatedAt:   tx.now,
+	}
+	query := `
+		INSERT INTO contact_requests (senderId, recipientId, state, createdAt, updatedAt)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	result, err := tx.ExecContext(ctx, query, senderId, recipientId, request.State, (*NullTime)(&request.CreatedAt), (*NullTime)(&request.UpdatedAt))
+	if err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok {
+			switch sqliteErr.ExtendedCode {
+			case sqlite3.ErrConstraintUnique:
+				return nil, goChat.NewConflictErr(info, op, "A contact request between you is already pending.", nil)
+			case sqlite3.ErrConstraintForeignKey:
+				return nil, goChat.NewNotFoundErr(info, op, "User not found.", nil)
+			}
+		}
+		return nil, goChat.NewInternalErr("inserting into contact_requests table", op, "", err)
+	}
+	if request.Id, err = result.LastInsertId(); err != nil {
+		return nil, goChat.NewInternalErr("getting last inserted id", op, "", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return request, nil
+}
+
+// Accepts a pending request sent to userId and adds both users to each
+// other's contact list.
+//
+// Returns ENotFound if request doesn't exist or wasn't sent to userId.
+// Returns EConflict if request isn't pending anymore.
+func (s *ContactService) AcceptRequest(ctx context.Context, userId, requestId goChat.Id) error {
+	const op = contactServiceOp + "AcceptRequest"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	request, err := transitionContactRequest(ctx, tx, requestId, "recipientId", userId, goChat.ContactRequestAccepted)
+	if err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+	if blocked, err := isBlocked(ctx, tx, request.SenderId, request.RecipientId); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	} else if blocked {
+		return goChat.NewNotFoundErr(fmt.Sprintf("requestId: %d", requestId), op, "Contact request not found.", nil)
+	}
+
+	query := `
+		INSERT INTO contacts (userId, contactId, createdAt)
+		VALUES (?, ?, ?), (?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`
+	_, err = tx.ExecContext(
+		ctx,
+		query,
+		request.SenderId, request.RecipientId, (*NullTime)(&tx.now),
+		request.RecipientId, request.SenderId, (*NullTime)(&tx.now),
+	)
+	if err != nil {
+		return goChat.NewInternalErr("inserting into contacts table", op, "", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
+
+// Declines a pending request sent to userId.
+//
+// Returns ENotFound if request doesn't exist or wasn't sent to userId.
+// Returns EConflict if request isn't pending anymore.
+func (s *ContactService) DeclineRequest(ctx context.Context, userId, requestId goChat.Id) error {
+	const op = contactServiceOp + "DeclineRequest"
+	return s.transition(ctx, op, requestId, "recipientId", userId, goChat.ContactRequestDeclined)
+}
+
+// Cancels a pending request sent by userId.
+//
+// Returns ENotFound if request doesn't exist or wasn't sent by userId.
+// Returns EConflict if request isn't pending anymore.
+func (s *ContactService) CancelRequest(ctx context.Context, userId, requestId goChat.Id) error {
+	const op = contactServiceOp + "CancelRequest"
+	return s.transition(ctx, op, requestId, "senderId", userId, goChat.ContactRequestCanceled)
+}
+
+// Retrieves pending requests sent by or to userId, most recent first.
+func (s *ContactService) FindPendingRequests(ctx context.Context, userId goChat.Id) ([]*goChat.ContactRequest, error) {
+	const op = contactServiceOp + "FindPendingRequests"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, senderId, recipientId, state, createdAt, updatedAt
+		FROM contact_requests
+		WHERE (senderId = ? OR recipientId = ?) AND state = ?
+		ORDER BY createdAt DESC, id DESC
+	`
+	rows, err := tx.QueryContext(ctx, query, userId, userId, goChat.ContactRequestPending)
+	if err != nil {
+		return nil, goChat.NewInternalErr("querying contact requests", op, "", err)
+	}
+	defer rows.Close()
+
+	requests := make([]*goChat.ContactRequest, 0)
+	for rows.Next() {
+		request := &goChat.ContactRequest{}
+		err := rows.Scan(
+			&request.Id,
+			&request.SenderId,
+			&request.RecipientId,
+			&request.State,
+			(*NullTime)(&request.CreatedAt),
+			(*NullTime)(&request.UpdatedAt),
+		)
+		if err != nil {
+			return nil, goChat.NewInternalErr("scanning row", op, "", err)
+		}
+		requests = append(requests, request)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, goChat.NewInternalErr("iterating rows", op, "", err)
+	}
+
+	return requests, nil
+}
+
+// Retrieves the contact list of userId.
+func (s *ContactService) FindContacts(ctx context.Context, userId goChat.Id) ([]*goChat.Contact, error) {
+	const op = contactServiceOp + "FindContacts"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	contacts, err := findContacts(ctx, tx, userId)
+	if err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+	return contacts, nil
+}
+
+// Sets the nickname userId gave contactId, "" removes it.
+//
+// Returns ENotFound if contactId isn't a contact of userId.
+// Returns EInvalid if nickname is too long.
+func (s *ContactService) SetNickname(ctx context.Context, userId, contactId goChat.Id, nickname string) error {
+	const op = contactServiceOp + "SetNickname"
+	if utf8.RuneCountInString(nickname) > goChat.MaxNicknameLength {
+		return goChat.NewInvalidFieldErr("nickname", "", op, fmt.Sprintf("Must be at most %d characters long.", goChat.MaxNicknameLength), nil)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE contacts SET nickname = ? WHERE userId = ? AND contactId = ?", nickname, userId, contactId)
+	if err != nil {
+		return goChat.NewInternalErr("updating contacts table", op, "", err)
+	}
+	if err = expectRowsAffected(result, op, "Contact not found."); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
+
+// Removes the users from each other's contact list.
+//
+// Returns ENotFound if contactId isn't a contact of userId.
+func (s *ContactService) RemoveContact(ctx context.Context, userId, contactId goChat.Id) error {
+	const op = contactServiceOp + "RemoveContact"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM contacts
+		WHERE (userId = ? AND contactId = ?) OR (userId = ? AND contactId = ?)
+	`
+	result, err := tx.ExecContext(ctx, query, userId, contactId, contactId, userId)
+	if err != nil {
+		return goChat.NewInternalErr("deleting from contacts table", op, "", err)
+	}
+	if err = expectRowsAffected(result, op, "Contact not found."); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
+
+// Sets whether userId only accepts direct messages from contacts.
+//
+// Returns ENotFound if user doesn't exist.
+func (s *ContactService) SetDirectMessagesFromContactsOnly(ctx context.Context, userId goChat.Id, contactsOnly bool) error {
+	const op = contactServiceOp + "SetDirectMessagesFromContactsOnly"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE users SET dmContactsOnly = ? WHERE id = ?", contactsOnly, userId)
+	if err != nil {
+		return goChat.NewInternalErr("updating users table", op, "", err)
+	}
+	if err = expectRowsAffected(result, op, "User not found."); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
+
+// Returns true if senderId may start a direct chat with recipientId,
+// taking blocks and the recipient's privacy setting into account.
+func (s *ContactService) CanSendDirectMessage(ctx context.Context, senderId, recipientId goChat.Id) (bool, error) {
+	const op = contactServiceOp + "CanSendDirectMessage"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	if blocked, err := isBlocked(ctx, tx, senderId, recipientId); err != nil {
+		return false, goChat.Error{Op: op, Err: err}
+	} else if blocked {
+		return false, nil
+	}
+
+	var contactsOnly bool
+	err = tx.QueryRowContext(ctx, "SELECT dmContactsOnly FROM users WHERE id = ?", recipientId).Scan(&contactsOnly)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, goChat.NewInternalErr("querying dmContactsOnly", op, "", err)
+	}
+	if !contactsOnly {
+		return true, nil
+	}
+
+	contact, err := isContact(ctx, tx, recipientId, senderId)
+	if err != nil {
+		return false, goChat.Error{Op: op, Err: err}
+	}
+	return contact, nil
+}
+
+func (s *ContactService) transition(ctx context.Context, op string, requestId goChat.Id, actorColumn string, actorId goChat.Id, state goChat.ContactRequestState) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = transitionContactRequest(ctx, tx, requestId, actorColumn, actorId, state); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
+
+// Moves a pending request to state. actorColumn is the column that has to
+// match actorId, "recipientId" or "senderId", and isn't escaped.
+// The state check is part of the UPDATE so racing transitions can't both succeed.
+//
+// Returns ENotFound if request doesn't exist or actorId may not act on it.
+// Returns EConflict if request isn't pending anymore.
+func transitionContactRequest(ctx context.Context, tx *Tx, requestId goChat.Id, actorColumn string, actorId goChat.Id, state goChat.ContactRequestState) (*goChat.ContactRequest, error) {
+	const op = "transitionContactRequest"
+	info := fmt.Sprintf("requestId: %d, %s: %d, state: %s", requestId, actorColumn, actorId, state)
+
+	query := `
+		UPDATE contact_requests
+		SET state = ?, updatedAt = ?
+		WHERE id = ? AND ` + actorColumn + ` = ? AND state = ?
+		RETURNING id, senderId, recipientId, state, createdAt, updatedAt
+	`
+	request := &goChat.ContactRequest{}
+	err := tx.QueryRowContext(ctx, query, state, (*NullTime)(&tx.now), requestId, actorId, goChat.ContactRequestPending).Scan(
+		&request.Id,
+		&request.SenderId,
+		&request.RecipientId,
+		&request.State,
+		(*NullTime)(&request.CreatedAt),
+		(*NullTime)(&request.UpdatedAt),
+	)
+	if err == nil {
+		return request, nil
+	} else if err != sql.ErrNoRows {
+		return nil, goChat.NewInternalErr(info, op, "", err)
+	}
+
+	// nothing updated, find out why
+	var exists bool
+	query = "SELECT EXISTS (SELECT 1 FROM contact_requests WHERE id = ? AND " + actorColumn + " = ?)"
+	if err := tx.QueryRowContext(ctx, query, requestId, actorId).Scan(&exists); err != nil {
+		return nil, goChat.NewInternalErr(info, op, "", err)
+	}
+	if !exists {
+		return nil, goChat.NewNotFoundErr(info, op, "Contact request not found.", nil)
+	}
+	return nil, goChat.NewConflictErr(info, op, "Contact request isn't pending anymore.", nil)
+}
+
+func findContacts(ctx context.Context, tx *Tx, userId goChat.Id) ([]*goChat.Contact, error) {
+	const op = "findContacts"
+
+	query := `
+		SELECT userId, contactId, nickname, createdAt FROM contacts
+		WHERE userId = ?
+		ORDER BY createdAt, contactId
+	`
+	rows, err := tx.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, goChat.NewInternalErr("querying contacts", op, "", err)
+	}
+	defer rows.Close()
+
+	contacts := make([]*goChat.Contact, 0)
+	for rows.Next() {
+		contact := &goChat.Contact{}
+		if err := rows.Scan(&contact.UserId, &contact.ContactId, &contact.Nickname, (*NullTime)(&contact.CreatedAt)); err != nil {
+			return nil, goChat.NewInternalErr("scanning row", op, "", err)
+		}
+		contacts = append(contacts, contact)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, goChat.NewInternalErr("iterating rows", op, "", err)
+	}
+
+	return contacts, nil
+}
+
+// Returns true if contactId is in the contact list of userId.
+func isContact(ctx context.Context, tx *Tx, userId, contactId goChat.Id) (bool, error) {
+	const op = "isContact"
+
+	var contact bool
+	query := "SELECT EXISTS (SELECT 1 FROM contacts WHERE userId = ? AND contactId = ?)"
+	if err := tx.QueryRowContext(ctx, query, userId, contactId).Scan(&contact); err != nil {
+		return false, goChat.NewInternalErr("querying contacts", op, "", err)
+	}
+	return contact, nil
+}
+
+// Returns ENotFound with message if result didn't affect any rows.
+func expectRowsAffected(result sql.Result, op, message string) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return goChat.NewInternalErr("getting rows affected", op, "", err)
+	}
+	if n == 0 {
+		return goChat.NewNotFoundErr("", op, message, nil)
+	}
+	return nil
+}
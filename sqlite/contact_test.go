@@ -0,0 +1,186 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adamni21/goChat"
+	"github.com/adamni21/goChat/sqlite"
+)
+
+func TestContactRequest(t *testing.T) {
+	s, db, closeDB, ctx := InitContactService(t)
+	defer closeDB()
+
+	userService := sqlite.NewUserService(db)
+	alice := MustCreateUser(t, ctx, userService, &goChat.User{Username: "alice", Email: "alice@mail.io"}, "password")
+	bob := MustCreateUser(t, ctx, userService, &goChat.User{Username: "bob", Email: "bob@mail.io"}, "password")
+
+	request, err := s.SendRequest(ctx, alice.Id, bob.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// return EConflict if a request between the users is pending, in either direction
+	t.Run("duplicate request", func(t *testing.T) {
+		_, err := s.SendRequest(ctx, bob.Id, alice.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EConflict {
+			t.Fatalf("expected EConflict got %+v", err)
+		}
+	})
+
+	// only the recipient can accept
+	t.Run("sender accepts", func(t *testing.T) {
+		err := s.AcceptRequest(ctx, alice.Id, request.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		}
+	})
+
+	t.Run("accept successfully", func(t *testing.T) {
+		if err := s.AcceptRequest(ctx, bob.Id, request.Id); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, ids := range [][2]goChat.Id{{alice.Id, bob.Id}, {bob.Id, alice.Id}} {
+			contacts, err := s.FindContacts(ctx, ids[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(contacts) != 1 || contacts[0].ContactId != ids[1] {
+				t.Fatalf("contacts of %d=%+v, want %d", ids[0], contacts, ids[1])
+			}
+		}
+
+		requests, err := s.FindPendingRequests(ctx, bob.Id)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(requests) != 0 {
+			t.Fatalf("expected no pending requests got %+v", requests)
+		}
+	})
+
+	// return EConflict once the request isn't pending
+	t.Run("cancel accepted request", func(t *testing.T) {
+		err := s.CancelRequest(ctx, alice.Id, request.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EConflict {
+			t.Fatalf("expected EConflict got %+v", err)
+		}
+	})
+
+	// return EConflict if users are contacts already
+	t.Run("request existing contact", func(t *testing.T) {
+		_, err := s.SendRequest(ctx, alice.Id, bob.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EConflict {
+			t.Fatalf("expected EConflict got %+v", err)
+		}
+	})
+
+	t.Run("set nickname", func(t *testing.T) {
+		if err := s.SetNickname(ctx, alice.Id, bob.Id, "Bobby"); err != nil {
+			t.Fatal(err)
+		}
+		contacts, err := s.FindContacts(ctx, alice.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contacts[0].Nickname != "Bobby" {
+			t.Fatalf("Nickname=%s, want %s", contacts[0].Nickname, "Bobby")
+		}
+	})
+
+	t.Run("remove contact", func(t *testing.T) {
+		if err := s.RemoveContact(ctx, bob.Id, alice.Id); err != nil {
+			t.Fatal(err)
+		}
+		contacts, err := s.FindContacts(ctx, alice.Id)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(contacts) != 0 {
+			t.Fatalf("expected no contacts got %+v", contacts)
+		}
+	})
+}
+
+func TestDeclineAndCancelContactRequest(t *testing.T) {
+	s, db, closeDB, ctx := InitContactService(t)
+	defer closeDB()
+
+	userService := sqlite.NewUserService(db)
+	alice := MustCreateUser(t, ctx, userService, &goChat.User{Username: "alice", Email: "alice@mail.io"}, "password")
+	bob := MustCreateUser(t, ctx, userService, &goChat.User{Username: "bob", Email: "bob@mail.io"}, "password")
+
+	request, err := s.SendRequest(ctx, alice.Id, bob.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeclineRequest(ctx, bob.Id, request.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	// a declined request doesn't prevent a new one
+	request, err = s.SendRequest(ctx, alice.Id, bob.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CancelRequest(ctx, alice.Id, request.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.AcceptRequest(ctx, bob.Id, request.Id)
+	if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EConflict {
+		t.Fatalf("expected EConflict got %+v", err)
+	}
+}
+
+func TestCanSendDirectMessage(t *testing.T) {
+	s, db, closeDB, ctx := InitContactService(t)
+	defer closeDB()
+
+	userService := sqlite.NewUserService(db)
+	alice := MustCreateUser(t, ctx, userService, &goChat.User{Username: "alice", Email: "alice@mail.io"}, "password")
+	bob := MustCreateUser(t, ctx, userService, &goChat.User{Username: "bob", Email: "bob@mail.io"}, "password")
+
+	assertCanSend := func(t *testing.T, want bool) {
+		t.Helper()
+		if got, err := s.CanSendDirectMessage(ctx, alice.Id, bob.Id); err != nil {
+			t.Fatal(err)
+		} else if got != want {
+			t.Fatalf("CanSendDirectMessage=%t, want %t", got, want)
+		}
+	}
+
+	assertCanSend(t, true)
+
+	if err := s.SetDirectMessagesFromContactsOnly(ctx, bob.Id, true); err != nil {
+		t.Fatal(err)
+	}
+	assertCanSend(t, false)
+
+	MustBeContacts(t, ctx, s, alice.Id, bob.Id)
+	assertCanSend(t, true)
+
+	if err := sqlite.NewBlockService(db).Block(ctx, bob.Id, alice.Id); err != nil {
+		t.Fatal(err)
+	}
+	assertCanSend(t, false)
+}
+
+// makes the users contacts of each other
+func MustBeContacts(tb testing.TB, ctx context.Context, s goChat.ContactService, userId1, userId2 goChat.Id) {
+	tb.Helper()
+	request, err := s.SendRequest(ctx, userId1, userId2)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := s.AcceptRequest(ctx, userId2, request.Id); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func InitContactService(tb testing.TB) (goChat.ContactService, *sqlite.DB, func(), context.Context) {
+	tb.Helper()
+	db := MustOpenDB(tb)
+	s := sqlite.NewContactService(db)
+	return s, db, func() { MustCloseDB(tb, db) }, context.Background()
+}
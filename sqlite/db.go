@@ -7,15 +7,39 @@ import (
 	"embed"
 	"fmt"
 	"io/fs"
+	"math"
 	"path"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/adamni21/goChat"
+	"github.com/adamni21/goChat/crypto"
+	"github.com/mattn/go-sqlite3"
 )
 
+// Name of the sqlite3 driver extended with the functions below, which
+// migrations and queries can use.
+const driverName = "sqlite3_goChat"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			// hash_token(token) returns crypto.HashToken(token)
+			if err := conn.RegisterFunc("hash_token", crypto.HashToken, true); err != nil {
+				return err
+			}
+			// lower_unicode(s) returns strings.ToLower(s), unlike lower() it folds non-ASCII letters
+			if err := conn.RegisterFunc("lower_unicode", strings.ToLower, true); err != nil {
+				return err
+			}
+			// username_skeleton(username) returns goChat.UsernameSkeleton(username)
+			return conn.RegisterFunc("username_skeleton", goChat.UsernameSkeleton, true)
+		},
+	})
+}
+
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
@@ -30,13 +54,13 @@ type DB struct {
 func NewDB(dsn string) *DB {
 	return &DB{
 		DSN: dsn,
-		Now: time.Now().UTC,
+		Now: func() time.Time { return time.Now().UTC() },
 	}
 }
 
 func (db *DB) Open() error {
 	var err error
-	if db.db, err = sql.Open("sqlite3", db.DSN); err != nil {
+	if db.db, err = sql.Open(driverName, db.DSN); err != nil {
 		return err
 	}
 	if err := db.db.Ping(); err != nil {
@@ -65,6 +89,11 @@ func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql
 }
 
 func (db *DB) migrate() error {
+	return db.migrateUpTo(math.MaxInt32)
+}
+
+// Applies the pending migrations with a timestamp up to maxTimestamp.
+func (db *DB) migrateUpTo(maxTimestamp int32) error {
 	currentUserVersion, err := db.currentUserVersion()
 	if err != nil {
 		return fmt.Errorf("getting current user_version: %w", err)
@@ -88,7 +117,7 @@ func (db *DB) migrate() error {
 			return fmt.Errorf("parsing timestamp '%s' gave error: %w", rawTimestamp, err)
 		}
 
-		if int32(timestamp) > currentUserVersion {
+		if int32(timestamp) > currentUserVersion && int32(timestamp) <= maxTimestamp {
 			files = append(files, migration{fileName: name, timestamp: int32(timestamp)})
 		}
 	}
@@ -109,10 +138,68 @@ func (db *DB) migrateFile(migration migration) error {
 		return err
 	}
 
-	if _, err := db.db.Exec(string(buf)); err != nil {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if check, ok := migrationChecks[migration.timestamp]; ok {
+		if err := check(tx); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(string(buf)); err != nil {
 		return err
 	}
+	// record the migration so it isn't applied again on the next Open
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d;", migration.timestamp)); err != nil {
+		return fmt.Errorf("setting user_version: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// Checks run in the transaction of a migration before it is applied. They
+// refuse data the migration would fail on part-way, naming the rows to fix.
+var migrationChecks = map[int32]func(tx *sql.Tx) error{
+	1688832740: func(tx *sql.Tx) error {
+		if err := checkUsersUnique(tx, "lower(email)", "email"); err != nil {
+			return err
+		}
+		return checkUsersUnique(tx, "username_skeleton(username)", "username skeleton")
+	},
+	1694954512: func(tx *sql.Tx) error {
+		return checkUsersUnique(tx, "username_skeleton(username)", "username skeleton")
+	},
+}
+
+// Returns an error listing the ids of users sharing a value of expr.
+func checkUsersUnique(tx *sql.Tx, expr, name string) error {
+	query := `
+		SELECT ` + expr + `, group_concat(id, ', ') FROM (SELECT * FROM users ORDER BY id)
+		GROUP BY 1 HAVING count(*) > 1
+	`
+	rows, err := tx.Query(query)
+	if err != nil {
+		return fmt.Errorf("checking unique %s: %w", name, err)
+	}
+	defer rows.Close()
 
+	var conflicts []string
+	for rows.Next() {
+		var value, ids string
+		if err := rows.Scan(&value, &ids); err != nil {
+			return fmt.Errorf("checking unique %s: %w", name, err)
+		}
+		conflicts = append(conflicts, fmt.Sprintf("users %s share %s %q", ids, name, value))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("checking unique %s: %w", name, err)
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("resolve before migrating: %s", strings.Join(conflicts, "; "))
+	}
 	return nil
 }
 
@@ -136,6 +223,20 @@ func (db *DB) Close() error {
 	return db.db.Close()
 }
 
+// Runs a single statement in its own transaction.
+func (db *DB) execTx(ctx context.Context, query string, args ...any) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
 	tx, err := db.db.BeginTx(ctx, opts)
 	if err != nil {
@@ -145,7 +246,7 @@ func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
 	return &Tx{
 		Tx:  tx,
 		db:  db,
-		now: time.Now().UTC().Truncate(time.Second),
+		now: db.Now().UTC().Truncate(time.Second),
 	}, nil
 }
 
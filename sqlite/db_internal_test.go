@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// users existing before usernames and emails were normalized
+func TestMigrateUniquenessConstraints(t *testing.T) {
+	db := NewDB(filepath.Join(t.TempDir(), "db"))
+	var err error
+	if db.db, err = sql.Open(driverName, db.DSN); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.migrateUpTo(1688390517); err != nil {
+		t.Fatal(err)
+	}
+
+	insert := `
+		INSERT INTO users (id, username, email, isVerified, passwordString, createdAt, updatedAt)
+		VALUES (?, ?, ?, 0, '', '', '')
+	`
+	for _, user := range []struct {
+		id              int
+		username, email string
+	}{
+		{1, "user0", "user0@mail.io"},
+		{2, "userO", "USER0@mail.io"},
+		{3, "user3", "user3@mail.io"},
+	} {
+		if _, err := db.db.Exec(insert, user.id, user.username, user.email); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// conflicting rows are named instead of failing part-way
+	err = db.migrate()
+	if err == nil || !strings.Contains(err.Error(), `users 1, 2 share email "user0@mail.io"`) {
+		t.Fatalf("expected email conflict, got %v", err)
+	}
+	if _, err := db.db.Exec("UPDATE users SET email = 'user2@mail.io' WHERE id = 2"); err != nil {
+		t.Fatal(err)
+	}
+	err = db.migrate()
+	if err == nil || !strings.Contains(err.Error(), `users 1, 2 share username skeleton "usero"`) {
+		t.Fatalf("expected username conflict, got %v", err)
+	}
+
+	if _, err := db.db.Exec("UPDATE users SET username = 'user2' WHERE id = 2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// skeletons match the ones computed on lookup
+	var skeleton string
+	if err := db.db.QueryRow("SELECT usernameSkeleton FROM users WHERE id = 1").Scan(&skeleton); err != nil {
+		t.Fatal(err)
+	}
+	if skeleton != "usero" {
+		t.Fatalf("skeleton=%q, want %q", skeleton, "usero")
+	}
+}
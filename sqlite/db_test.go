@@ -1,6 +1,7 @@
 package sqlite_test
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/adamni21/goChat/sqlite"
@@ -11,6 +12,18 @@ func TestDB(t *testing.T) {
 	MustCloseDB(t, db)
 }
 
+// migrations must only be applied once to a persistent db
+func TestDBReopen(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "db")
+	for i := 0; i < 2; i++ {
+		db := sqlite.NewDB(dsn)
+		if err := db.Open(); err != nil {
+			t.Fatalf("open %d: %v", i, err)
+		}
+		MustCloseDB(t, db)
+	}
+}
+
 func MustOpenDB(tb testing.TB) *sqlite.DB {
 	tb.Helper()
 
@@ -0,0 +1,255 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/adamni21/goChat"
+	"github.com/adamni21/goChat/crypto"
+)
+
+const emailChangeServiceOp = "sqlite.EmailChangeService."
+
+// EmailChangeService represents a service for changing email addresses.
+type EmailChangeService struct {
+	db     *DB
+	mailer goChat.Mailer
+
+	// How long a confirmation token stays valid.
+	TokenLifetime time.Duration
+	// How long the previous address can revert a confirmed change.
+	RevertLifetime time.Duration
+	// Min time between two confirmation mails of the same user.
+	ResendInterval time.Duration
+	// Receives errors of change notifications, which are delivered in the
+	// background. May be nil.
+	OnMailErr func(error)
+
+	mails *mailQueue
+}
+
+// returns new instance of EmailChangeService
+func NewEmailChangeService(db *DB, mailer goChat.Mailer) *EmailChangeService {
+	return &EmailChangeService{
+		db:             db,
+		mailer:         mailer,
+		mails:          &mailQueue{mailer: mailer},
+		TokenLifetime:  24 * time.Hour,
+		RevertLifetime: 7 * 24 * time.Hour,
+		ResendInterval: time.Minute,
+	}
+}
+
+// Mails a single-use confirmation token to newEmail. The user's email
+// stays unchanged until the token is confirmed. Replaces any pending
+// change of the user.
+//
+// Returns ENotFound if user doesn't exist.
+// Returns EInvalid if newEmail isn't a valid address or equals the current one.
+// Returns EConflict if newEmail is already registered.
+// Returns ERateLimited if a token was sent to the user too recently.
+func (s *EmailChangeService) RequestEmailChange(ctx context.Context, userId goChat.Id, newEmail string) error {
+	const op = emailChangeServiceOp + "RequestEmailChange"
+
+	newEmail, err := goChat.NormalizeEmail(newEmail)
+	if err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	user, err := findUserBy(ctx, tx, "id", userId)
+	if err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+	if user.Email == newEmail {
+		return goChat.NewInvalidFieldErr("email", "", op, "This is already your email address.", nil)
+	}
+
+	// checked again on confirmation, this only spares mailing a token that can't be confirmed
+	if _, err = findUserBy(ctx, tx, "email", newEmail); err == nil {
+		return goChat.NewConflictFieldErr("email", "", op, "Email address is already registered.", nil)
+	} else if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	var lastSent NullTime
+	query := `
+		SELECT max(createdAt) FROM email_changes
+		WHERE userId = ?
+	`
+	if err = tx.QueryRowContext(ctx, query, userId).Scan(&lastSent); err != nil {
+		return goChat.NewInternalErr("querying last email change", op, "", err)
+	}
+	if wait := time.Time(lastSent).Add(s.ResendInterval).Sub(tx.now); wait > 0 {
+		info := fmt.Sprintf("userId: %d, retry after: %s", userId, wait)
+		return goChat.NewRateLimitedErr(info, op, "Confirmation mail was sent recently, try again later.", nil)
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM email_changes WHERE userId = ? AND confirmedAt IS NULL", userId); err != nil {
+		return goChat.NewInternalErr("deleting pending email changes", op, "", err)
+	}
+
+	token, err := crypto.GenerateToken()
+	if err != nil {
+		return goChat.NewInternalErr("generating token", op, "", err)
+	}
+	expiry := tx.now.Add(s.TokenLifetime)
+
+	query = `
+		INSERT INTO email_changes (userId, oldEmail, newEmail, confirmTokenHash, confirmExpiry, createdAt)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	_, err = tx.ExecContext(ctx, query, userId, user.Email, newEmail, crypto.HashToken(token), (*NullTime)(&expiry), (*NullTime)(&tx.now))
+	if err != nil {
+		return goChat.NewInternalErr("inserting into email_changes table", op, "", err)
+	}
+
+	// commit before mailing so the write lock isn't held during delivery
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	err = s.mailer.Send(ctx, goChat.Mail{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body:    fmt.Sprintf("Use this code to confirm your new email address:\n\n%s\n\nThe code expires at %s.", token, expiry.Format(time.RFC1123)),
+	})
+	if err != nil {
+		// a failed delivery shouldn't count towards ResendInterval
+		if delErr := s.db.execTx(ctx, "DELETE FROM email_changes WHERE confirmTokenHash = ?", crypto.HashToken(token)); delErr != nil {
+			return goChat.NewInternalErr("deleting undelivered email change", op, "", delErr)
+		}
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	return nil
+}
+
+// Changes the user's email to the address the token was issued for and
+// mails a revert token to the previous address in the background.
+//
+// Returns ENotFound if token doesn't exist or has expired.
+// Returns EConflict if the address was registered in the meantime.
+func (s *EmailChangeService) ConfirmEmailChange(ctx context.Context, token string) error {
+	const op = emailChangeServiceOp + "ConfirmEmailChange"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	var changeId, userId goChat.Id
+	var oldEmail, newEmail string
+	var expiry time.Time
+	query := `
+		SELECT id, userId, oldEmail, newEmail, confirmExpiry FROM email_changes
+		WHERE confirmTokenHash = ? AND confirmedAt IS NULL
+	`
+	err = tx.QueryRowContext(ctx, query, crypto.HashToken(token)).Scan(&changeId, &userId, &oldEmail, &newEmail, (*NullTime)(&expiry))
+	if err == sql.ErrNoRows || (err == nil && !tx.now.Before(expiry)) {
+		return goChat.NewNotFoundErr("", op, "Invalid or expired confirmation code.", nil)
+	} else if err != nil {
+		return goChat.NewInternalErr("querying email change", op, "", err)
+	}
+
+	// the UNIQUE constraint on users.email rejects addresses registered since the request
+	if err = updateEmail(ctx, tx, userId, newEmail); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+	// receiving the token proves ownership of the new address
+	if _, err = tx.ExecContext(ctx, "UPDATE users SET isVerified = 1 WHERE id = ?", userId); err != nil {
+		return goChat.NewInternalErr("updating users table", op, "", err)
+	}
+
+	revertToken, err := crypto.GenerateToken()
+	if err != nil {
+		return goChat.NewInternalErr("generating token", op, "", err)
+	}
+	revertExpiry := tx.now.Add(s.RevertLifetime)
+
+	query = `
+		UPDATE email_changes
+		SET confirmedAt = ?, revertTokenHash = ?, revertExpiry = ?
+		WHERE id = ?
+	`
+	_, err = tx.ExecContext(ctx, query, (*NullTime)(&tx.now), crypto.HashToken(revertToken), (*NullTime)(&revertExpiry), changeId)
+	if err != nil {
+		return goChat.NewInternalErr("updating email_changes table", op, "", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	// the change is done, so a failed notification is reported to OnMailErr instead of the caller
+	s.mails.enqueue(goChat.Mail{
+		To:      oldEmail,
+		Subject: "Your email address was changed",
+		Body: fmt.Sprintf(
+			"If you didn't change your email address to %s, use this code to restore it and log out all devices:\n\n%s\n\nThe code expires at %s.",
+			newEmail, revertToken, revertExpiry.Format(time.RFC1123),
+		),
+	}, s.OnMailErr)
+
+	return nil
+}
+
+// Blocks until all notifications sent so far are delivered or failed.
+// Call it before shutting down.
+func (s *EmailChangeService) Wait() {
+	s.mails.wait()
+}
+
+// Restores the address the email was changed from and logs the user
+// out everywhere, in case the change was made by someone else.
+//
+// Returns ENotFound if token doesn't exist or has expired.
+// Returns EConflict if the previous address was registered in the meantime.
+func (s *EmailChangeService) RevertEmailChange(ctx context.Context, token string) error {
+	const op = emailChangeServiceOp + "RevertEmailChange"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	var userId goChat.Id
+	var oldEmail string
+	var expiry time.Time
+	query := `
+		SELECT userId, oldEmail, revertExpiry FROM email_changes
+		WHERE revertTokenHash = ?
+	`
+	err = tx.QueryRowContext(ctx, query, crypto.HashToken(token)).Scan(&userId, &oldEmail, (*NullTime)(&expiry))
+	if err == sql.ErrNoRows || (err == nil && !tx.now.Before(expiry)) {
+		return goChat.NewNotFoundErr("", op, "Invalid or expired code.", nil)
+	} else if err != nil {
+		return goChat.NewInternalErr("querying email change", op, "", err)
+	}
+
+	if err = updateEmail(ctx, tx, userId, oldEmail); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+	if err = deleteUserSessions(ctx, tx, userId, ""); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+	// also invalidates changes requested by whoever made this one
+	if _, err = tx.ExecContext(ctx, "DELETE FROM email_changes WHERE userId = ?", userId); err != nil {
+		return goChat.NewInternalErr("deleting email changes", op, "", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adamni21/goChat"
+	"github.com/adamni21/goChat/inmem"
+	"github.com/adamni21/goChat/sqlite"
+)
+
+func TestEmailChange(t *testing.T) {
+	t.Run("confirm and revert", func(t *testing.T) {
+		s, mailer, db, cleanup, ctx := InitEmailChangeService(t)
+		defer cleanup()
+		userService := sqlite.NewUserService(db)
+		user := MustCreateUser(t, ctx, userService, &goChat.User{Username: "user0", Email: "old@mail.io"}, "password")
+		session := &goChat.Session{UserId: user.Id}
+		MustCreateSession(t, ctx, db, session)
+
+		if err := s.RequestEmailChange(ctx, user.Id, "New@mail.io"); err != nil {
+			t.Fatal(err)
+		}
+		mail, ok := mailer.LastMailTo("new@mail.io")
+		if !ok {
+			t.Fatal("no confirmation mail sent to the new address")
+		}
+
+		// not active until confirmed
+		if user, err := userService.FindById(ctx, user.Id); err != nil {
+			t.Fatal(err)
+		} else if user.Email != "old@mail.io" {
+			t.Fatalf("email changed to %q before confirmation", user.Email)
+		}
+
+		if err := s.ConfirmEmailChange(ctx, TokenFromMail(t, mail)); err != nil {
+			t.Fatal(err)
+		}
+		if user, err := userService.FindById(ctx, user.Id); err != nil {
+			t.Fatal(err)
+		} else if user.Email != "new@mail.io" || !user.Verified {
+			t.Fatalf("unexpected user after confirmation %+v", user)
+		}
+
+		err := s.ConfirmEmailChange(ctx, TokenFromMail(t, mail))
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound on reuse got %+v", err)
+		}
+
+		s.Wait()
+		notification, ok := mailer.LastMailTo("old@mail.io")
+		if !ok {
+			t.Fatal("no notification sent to the old address")
+		}
+		if err := s.RevertEmailChange(ctx, TokenFromMail(t, notification)); err != nil {
+			t.Fatal(err)
+		}
+		if user, err := userService.FindById(ctx, user.Id); err != nil {
+			t.Fatal(err)
+		} else if user.Email != "old@mail.io" {
+			t.Fatalf("email %q not reverted", user.Email)
+		}
+
+		_, err = sqlite.NewAuthService(db).FindSession(ctx, session.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected session to be revoked got %+v", err)
+		}
+	})
+
+	// pending addresses aren't reserved, the first to confirm wins
+	t.Run("conflict at confirmation", func(t *testing.T) {
+		s, mailer, db, cleanup, ctx := InitEmailChangeService(t)
+		defer cleanup()
+		userService := sqlite.NewUserService(db)
+		user0 := MustCreateUser(t, ctx, userService, &goChat.User{Username: "user0", Email: "user0@mail.io"}, "password")
+		user1 := MustCreateUser(t, ctx, userService, &goChat.User{Username: "user1", Email: "user1@mail.io"}, "password")
+
+		if err := s.RequestEmailChange(ctx, user0.Id, "shared@mail.io"); err != nil {
+			t.Fatal(err)
+		}
+		token0 := TokenFromMail(t, mailer.Mails()[0])
+		if err := s.RequestEmailChange(ctx, user1.Id, "shared@mail.io"); err != nil {
+			t.Fatal(err)
+		}
+		token1 := TokenFromMail(t, mailer.Mails()[1])
+
+		if err := s.ConfirmEmailChange(ctx, token1); err != nil {
+			t.Fatal(err)
+		}
+		err := s.ConfirmEmailChange(ctx, token0)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EConflict {
+			t.Fatalf("expected EConflict got %+v", err)
+		}
+
+		// registered addresses are refused right away
+		err = s.RequestEmailChange(ctx, user0.Id, "shared@mail.io")
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EConflict {
+			t.Fatalf("expected EConflict got %+v", err)
+		}
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		s, _, db, cleanup, ctx := InitEmailChangeService(t)
+		defer cleanup()
+		user := MustCreateUser(t, ctx, sqlite.NewUserService(db), &goChat.User{Username: "user0", Email: "test@mail.io"}, "password")
+
+		if err := s.RequestEmailChange(ctx, user.Id, "new@mail.io"); err != nil {
+			t.Fatal(err)
+		}
+		err := s.RequestEmailChange(ctx, user.Id, "other@mail.io")
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ERateLimited {
+			t.Fatalf("expected ERateLimited got %+v", err)
+		}
+	})
+}
+
+func InitEmailChangeService(tb testing.TB) (*sqlite.EmailChangeService, *inmem.Mailer, *sqlite.DB, func(), context.Context) {
+	tb.Helper()
+	db := MustOpenDB(tb)
+	mailer := inmem.NewMailer()
+	s := sqlite.NewEmailChangeService(db, mailer)
+	return s, mailer, db, func() { MustCloseDB(tb, db) }, context.Background()
+}
@@ -0,0 +1,666 @@
+package sqlite
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adamni21/goChat"
+	"github.com/adamni21/goChat/crypto"
+)
+
+const dataExportServiceOp = "sqlite.DataExportService."
+
+// DataExportService builds ZIP archives with JSON files of everything
+// stored about a user.
+type DataExportService struct {
+	db *DB
+
+	// Directory the archives are written to.
+	Dir string
+	// How long a finished archive can be downloaded.
+	Lifetime time.Duration
+	// How long a running export may go without progress before another
+	// worker takes it over, e.g. because its worker crashed.
+	RunningTimeout time.Duration
+}
+
+// returns new instance of DataExportService
+func NewDataExportService(db *DB, dir string) *DataExportService {
+	return &DataExportService{
+		db:             db,
+		Dir:            dir,
+		Lifetime:       7 * 24 * time.Hour,
+		RunningTimeout: 30 * time.Minute,
+	}
+}
+
+// Queues an export of all data stored about userId. If an export of the
+// user is already pending or running, that export is returned instead.
+//
+// Returns ENotFound if user doesn't exist.
+func (s *DataExportService) RequestExport(ctx context.Context, userId goChat.Id) (*goChat.DataExport, error) {
+	const op = dataExportServiceOp + "RequestExport"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := findUserBy(ctx, tx, "id", userId); err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+
+	export, err := findDataExport(ctx, tx, "userId = ? AND status IN ('pending', 'running')", userId)
+	if err == nil {
+		return export, nil
+	} else if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+
+	export = &goChat.DataExport{
+		UserId:    userId,
+		Status:    goChat.ExportPending,
+		CreatedAt: tx.now,
+		UpdatedAt: tx.now,
+	}
+	query := `
+		INSERT INTO data_exports (userId, status, createdAt, updatedAt)
+		VALUES (?, ?, ?, ?)
+	`
+	result, err := tx.ExecContext(ctx, query, userId, export.Status, (*NullTime)(&export.CreatedAt), (*NullTime)(&export.UpdatedAt))
+	if err != nil {
+		return nil, goChat.NewInternalErr("inserting into data_exports table", op, "", err)
+	}
+	if export.Id, err = result.LastInsertId(); err != nil {
+		return nil, goChat.NewInternalErr("getting last inserted id", op, "", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return export, nil
+}
+
+// Retrieves the most recent export of userId.
+//
+// Returns ENotFound if user has no export.
+func (s *DataExportService) FindExport(ctx context.Context, userId goChat.Id) (*goChat.DataExport, error) {
+	const op = dataExportServiceOp + "FindExport"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	export, err := findDataExport(ctx, tx, "userId = ?", userId)
+	if err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+	return export, nil
+}
+
+// Builds the archive of the oldest pending export, or of a running
+// export whose worker stopped updating it.
+// Returns false if no export was pending.
+func (s *DataExportService) ProcessNextExport(ctx context.Context) (bool, error) {
+	const op = dataExportServiceOp + "ProcessNextExport"
+
+	export, err := s.claimNextExport(ctx)
+	if err != nil {
+		return false, goChat.Error{Op: op, Err: err}
+	} else if export == nil {
+		return false, nil
+	}
+
+	fileName, err := s.buildArchive(ctx, export)
+	if err != nil {
+		if updateErr := s.updateExport(ctx, export, goChat.ExportFailed, "", time.Time{}); updateErr != nil {
+			return true, goChat.Error{Op: op, Err: updateErr}
+		}
+		return true, goChat.Error{Op: op, Err: err}
+	}
+
+	export.Progress = 100
+	if err := s.updateExport(ctx, export, goChat.ExportDone, fileName, s.db.Now().Add(s.Lifetime)); err != nil {
+		os.Remove(filepath.Join(s.Dir, fileName))
+		return true, goChat.Error{Op: op, Err: err}
+	}
+
+	return true, nil
+}
+
+// Processes pending exports every interval until ctx is done.
+// Errors are passed to onErr, which may be nil.
+func (s *DataExportService) Run(ctx context.Context, interval time.Duration, onErr func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				processed, err := s.ProcessNextExport(ctx)
+				if err != nil && onErr != nil {
+					onErr(err)
+				}
+				if !processed {
+					break
+				}
+			}
+			if _, err := s.PruneExpiredExports(ctx); err != nil && onErr != nil {
+				onErr(err)
+			}
+		}
+	}
+}
+
+// Deletes expired archives and their exports, as well as archives whose
+// export no longer exists, e.g. because the user was deleted. Archives
+// of running exports are kept.
+// Returns the number of deleted exports.
+func (s *DataExportService) PruneExpiredExports(ctx context.Context) (int, error) {
+	const op = dataExportServiceOp + "PruneExpiredExports"
+
+	// listed before reading the exports: an archive is only created after its
+	// export is marked running, so every archive listed here is either still
+	// running below or finished, failed or deleted
+	archives, err := filepath.Glob(filepath.Join(s.Dir, "export-*.zip"))
+	if err != nil {
+		return 0, goChat.NewInternalErr("listing archives", op, "", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	now := s.db.Now()
+	query := `
+		DELETE FROM data_exports
+		WHERE expiresAt IS NOT NULL AND expiresAt <= ?
+	`
+	result, err := tx.ExecContext(ctx, query, (*NullTime)(&now))
+	if err != nil {
+		return 0, goChat.NewInternalErr("deleting from data_exports table", op, "", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, goChat.NewInternalErr("getting rows affected", op, "", err)
+	}
+
+	live := make(map[string]bool)
+	running := make(map[goChat.Id]bool)
+	rows, err := tx.QueryContext(ctx, "SELECT id, status, fileName FROM data_exports WHERE fileName != '' OR status = 'running'")
+	if err != nil {
+		return 0, goChat.NewInternalErr("querying data_exports", op, "", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id goChat.Id
+		var status goChat.ExportStatus
+		var fileName string
+		if err := rows.Scan(&id, &status, &fileName); err != nil {
+			return 0, goChat.NewInternalErr("scanning row", op, "", err)
+		}
+		if fileName != "" {
+			live[fileName] = true
+		}
+		if status == goChat.ExportRunning {
+			running[id] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, goChat.NewInternalErr("iterating rows", op, "", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	for _, path := range archives {
+		var id goChat.Id
+		fmt.Sscanf(filepath.Base(path), "export-%d-", &id)
+		if live[filepath.Base(path)] || running[id] {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return int(n), goChat.NewInternalErr(fmt.Sprintf("removing archive %s", path), op, "", err)
+		}
+	}
+
+	return int(n), nil
+}
+
+// Marks the oldest pending export, or a running one that timed out, as
+// running and returns it. Taking over an export increments its attempts,
+// which stops the previous worker from updating it.
+// Returns nil if no export is pending.
+func (s *DataExportService) claimNextExport(ctx context.Context) (*goChat.DataExport, error) {
+	const op = dataExportServiceOp + "claimNextExport"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	timedOut := tx.now.Add(-s.RunningTimeout)
+	query := `
+		UPDATE data_exports
+		SET status = 'running', progress = 0, attempts = attempts + 1, updatedAt = ?
+		WHERE id = (
+			SELECT id FROM data_exports
+			WHERE status = 'pending' OR (status = 'running' AND updatedAt <= ?)
+			ORDER BY id LIMIT 1
+		)
+		RETURNING ` + dataExportColumns
+	export, err := scanDataExport(tx.QueryRowContext(ctx, query, (*NullTime)(&tx.now), (*NullTime)(&timedOut)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, goChat.NewInternalErr("claiming export", op, "", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return export, nil
+}
+
+// Sets the status and progress of export, unless another worker took it over.
+//
+// Returns EConflict if the export was taken over.
+func (s *DataExportService) updateExport(ctx context.Context, export *goChat.DataExport, status goChat.ExportStatus, fileName string, expiresAt time.Time) error {
+	const op = dataExportServiceOp + "updateExport"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	expiresAt = expiresAt.Truncate(time.Second)
+	query := `
+		UPDATE data_exports
+		SET status = ?, progress = ?, fileName = ?, expiresAt = ?, updatedAt = ?
+		WHERE id = ? AND attempts = ?
+	`
+	result, err := tx.ExecContext(ctx, query, status, export.Progress, fileName, (*NullTime)(&expiresAt), (*NullTime)(&tx.now), export.Id, export.Attempts)
+	if err != nil {
+		return goChat.NewInternalErr("updating data_exports table", op, "", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return goChat.NewInternalErr("getting rows affected", op, "", err)
+	} else if n == 0 {
+		info := fmt.Sprintf("exportId: %d, attempt: %d", export.Id, export.Attempts)
+		return goChat.NewConflictErr(info, op, "Export was taken over by another worker.", nil)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
+
+// One JSON file in the archive and the query collecting its data.
+type exportSection struct {
+	fileName string
+	collect  func(ctx context.Context, tx *Tx, userId goChat.Id) (any, error)
+}
+
+var exportSections = []exportSection{
+	{"user.json", exportUser},
+	{"sessions.json", exportSessions},
+	{"contacts.json", exportContacts},
+	{"contact_requests.json", exportContactRequests},
+	{"blocks.json", exportBlocks},
+	{"preferences.json", exportPreferences},
+	{"suspensions.json", exportSuspensions},
+	{"email_changes.json", exportEmailChanges},
+}
+
+// Writes the archive of export and returns its file name.
+// The name contains a random part so download links can't be guessed.
+func (s *DataExportService) buildArchive(ctx context.Context, export *goChat.DataExport) (string, error) {
+	const op = dataExportServiceOp + "buildArchive"
+
+	random, err := crypto.GenerateRandomBytes(16)
+	if err != nil {
+		return "", goChat.NewInternalErr("generating random bytes", op, "", err)
+	}
+	fileName := fmt.Sprintf("export-%d-%s.zip", export.Id, hex.EncodeToString(random))
+	path := filepath.Join(s.Dir, fileName)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", goChat.NewInternalErr("creating archive", op, "", err)
+	}
+	defer f.Close()
+
+	if err := s.writeArchive(ctx, f, export); err != nil {
+		os.Remove(path)
+		return "", goChat.Error{Op: op, Err: err}
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return "", goChat.NewInternalErr("closing archive", op, "", err)
+	}
+
+	return fileName, nil
+}
+
+func (s *DataExportService) writeArchive(ctx context.Context, f *os.File, export *goChat.DataExport) error {
+	const op = dataExportServiceOp + "writeArchive"
+
+	data, err := s.collect(ctx, export.UserId)
+	if err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	zw := zip.NewWriter(f)
+	for i, section := range exportSections {
+		w, err := zw.Create(section.fileName)
+		if err != nil {
+			return goChat.NewInternalErr("creating "+section.fileName, op, "", err)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data[i]); err != nil {
+			return goChat.NewInternalErr("encoding "+section.fileName, op, "", err)
+		}
+
+		export.Progress = (i + 1) * 100 / (len(exportSections) + 1)
+		if err := s.updateExport(ctx, export, goChat.ExportRunning, "", time.Time{}); err != nil {
+			return goChat.Error{Op: op, Err: err}
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return goChat.NewInternalErr("closing zip writer", op, "", err)
+	}
+	return nil
+}
+
+// Collects the data of every section in a single read transaction, so the
+// sections are consistent with each other.
+func (s *DataExportService) collect(ctx context.Context, userId goChat.Id) ([]any, error) {
+	const op = dataExportServiceOp + "collect"
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	data := make([]any, len(exportSections))
+	for i, section := range exportSections {
+		if data[i], err = section.collect(ctx, tx, userId); err != nil {
+			return nil, goChat.Error{Op: op, Err: err}
+		}
+	}
+	return data, nil
+}
+
+type exportedUser struct {
+	Id               goChat.Id      `json:"id"`
+	Username         string         `json:"username"`
+	Email            string         `json:"email"`
+	Verified         bool           `json:"verified"`
+	Profile          goChat.Profile `json:"profile"`
+	DMContactsOnly   bool           `json:"directMessagesFromContactsOnly"`
+	PresenceAudience string         `json:"presenceAudience"`
+	LastSeenAudience string         `json:"lastSeenAudience"`
+	LastSeenAt       *time.Time     `json:"lastSeenAt"`
+	CreatedAt        time.Time      `json:"createdAt"`
+	UpdatedAt        time.Time      `json:"updatedAt"`
+}
+
+func exportUser(ctx context.Context, tx *Tx, userId goChat.Id) (any, error) {
+	const op = "exportUser"
+
+	user, err := findUserBy(ctx, tx, "id", userId)
+	if err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+
+	exported := exportedUser{
+		Id:        user.Id,
+		Username:  user.Username,
+		Email:     user.Email,
+		Verified:  user.Verified,
+		Profile:   user.Profile,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+	var lastSeenAt time.Time
+	query := `
+		SELECT dmContactsOnly, presenceAudience, lastSeenAudience, lastSeenAt
+		FROM users WHERE id = ?
+	`
+	err = tx.QueryRowContext(ctx, query, userId).Scan(
+		&exported.DMContactsOnly,
+		&exported.PresenceAudience,
+		&exported.LastSeenAudience,
+		(*NullTime)(&lastSeenAt),
+	)
+	if err != nil {
+		return nil, goChat.NewInternalErr("querying user settings", op, "", err)
+	}
+	if !lastSeenAt.IsZero() {
+		exported.LastSeenAt = &lastSeenAt
+	}
+
+	return exported, nil
+}
+
+type exportedSession struct {
+	Expiry time.Time `json:"expiry"`
+}
+
+// Session ids are credentials, only their expiry is exported.
+func exportSessions(ctx context.Context, tx *Tx, userId goChat.Id) (any, error) {
+	return exportRows(ctx, tx, "SELECT expiry FROM sessions WHERE userId = ? ORDER BY expiry", userId,
+		func(rows *sql.Rows) (exportedSession, error) {
+			var s exportedSession
+			err := rows.Scan((*NullTime)(&s.Expiry))
+			return s, err
+		})
+}
+
+type exportedContact struct {
+	ContactId goChat.Id `json:"contactId"`
+	Nickname  string    `json:"nickname"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func exportContacts(ctx context.Context, tx *Tx, userId goChat.Id) (any, error) {
+	return exportRows(ctx, tx, "SELECT contactId, nickname, createdAt FROM contacts WHERE userId = ? ORDER BY createdAt", userId,
+		func(rows *sql.Rows) (exportedContact, error) {
+			var c exportedContact
+			err := rows.Scan(&c.ContactId, &c.Nickname, (*NullTime)(&c.CreatedAt))
+			return c, err
+		})
+}
+
+type exportedContactRequest struct {
+	SenderId    goChat.Id `json:"senderId"`
+	RecipientId goChat.Id `json:"recipientId"`
+	State       string    `json:"state"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+func exportContactRequests(ctx context.Context, tx *Tx, userId goChat.Id) (any, error) {
+	query := `
+		SELECT senderId, recipientId, state, createdAt, updatedAt FROM contact_requests
+		WHERE senderId = ?1 OR recipientId = ?1
+		ORDER BY createdAt
+	`
+	return exportRows(ctx, tx, query, userId,
+		func(rows *sql.Rows) (exportedContactRequest, error) {
+			var r exportedContactRequest
+			err := rows.Scan(&r.SenderId, &r.RecipientId, &r.State, (*NullTime)(&r.CreatedAt), (*NullTime)(&r.UpdatedAt))
+			return r, err
+		})
+}
+
+type exportedBlock struct {
+	BlockedId goChat.Id `json:"blockedId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Only blocks created by the user are exported, being blocked by
+// someone else is that user's data.
+func exportBlocks(ctx context.Context, tx *Tx, userId goChat.Id) (any, error) {
+	return exportRows(ctx, tx, "SELECT blockedId, createdAt FROM blocks WHERE blockerId = ? ORDER BY createdAt", userId,
+		func(rows *sql.Rows) (exportedBlock, error) {
+			var b exportedBlock
+			err := rows.Scan(&b.BlockedId, (*NullTime)(&b.CreatedAt))
+			return b, err
+		})
+}
+
+type exportedPreference struct {
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// Only preferences the user has set are exported, defaults aren't user data.
+func exportPreferences(ctx context.Context, tx *Tx, userId goChat.Id) (any, error) {
+	return exportRows(ctx, tx, "SELECT key, value, updatedAt FROM preferences WHERE userId = ? ORDER BY key", userId,
+		func(rows *sql.Rows) (exportedPreference, error) {
+			var p exportedPreference
+			var raw string
+			err := rows.Scan(&p.Key, &raw, (*NullTime)(&p.UpdatedAt))
+			p.Value = json.RawMessage(raw)
+			return p, err
+		})
+}
+
+type exportedSuspension struct {
+	Reason    string     `json:"reason"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	LiftedAt  *time.Time `json:"liftedAt"`
+}
+
+// Suspensions are exported without the administrators involved.
+func exportSuspensions(ctx context.Context, tx *Tx, userId goChat.Id) (any, error) {
+	return exportRows(ctx, tx, "SELECT reason, createdAt, expiresAt, liftedAt FROM suspensions WHERE userId = ? ORDER BY id", userId,
+		func(rows *sql.Rows) (exportedSuspension, error) {
+			var s exportedSuspension
+			var expiresAt, liftedAt time.Time
+			err := rows.Scan(&s.Reason, (*NullTime)(&s.CreatedAt), (*NullTime)(&expiresAt), (*NullTime)(&liftedAt))
+			if !expiresAt.IsZero() {
+				s.ExpiresAt = &expiresAt
+			}
+			if !liftedAt.IsZero() {
+				s.LiftedAt = &liftedAt
+			}
+			return s, err
+		})
+}
+
+type exportedEmailChange struct {
+	OldEmail    string     `json:"oldEmail"`
+	NewEmail    string     `json:"newEmail"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ConfirmedAt *time.Time `json:"confirmedAt"`
+}
+
+// Confirm and revert tokens are credentials, only the addresses and times
+// are exported.
+func exportEmailChanges(ctx context.Context, tx *Tx, userId goChat.Id) (any, error) {
+	return exportRows(ctx, tx, "SELECT oldEmail, newEmail, createdAt, confirmedAt FROM email_changes WHERE userId = ? ORDER BY id", userId,
+		func(rows *sql.Rows) (exportedEmailChange, error) {
+			var c exportedEmailChange
+			var confirmedAt time.Time
+			err := rows.Scan(&c.OldEmail, &c.NewEmail, (*NullTime)(&c.CreatedAt), (*NullTime)(&confirmedAt))
+			if !confirmedAt.IsZero() {
+				c.ConfirmedAt = &confirmedAt
+			}
+			return c, err
+		})
+}
+
+func exportRows[T any](ctx context.Context, tx *Tx, query string, userId goChat.Id, scan func(*sql.Rows) (T, error)) ([]T, error) {
+	const op = "exportRows"
+
+	rows, err := tx.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, goChat.NewInternalErr("querying rows", op, "", err)
+	}
+	defer rows.Close()
+
+	result := make([]T, 0)
+	for rows.Next() {
+		v, err := scan(rows)
+		if err != nil {
+			return nil, goChat.NewInternalErr("scanning row", op, "", err)
+		}
+		result = append(result, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, goChat.NewInternalErr("iterating rows", op, "", err)
+	}
+	return result, nil
+}
+
+const dataExportColumns = `id, userId, status, progress, fileName, attempts, createdAt, updatedAt, expiresAt`
+
+func scanDataExport(row interface{ Scan(...any) error }) (*goChat.DataExport, error) {
+	export := &goChat.DataExport{}
+	err := row.Scan(
+		&export.Id,
+		&export.UserId,
+		&export.Status,
+		&export.Progress,
+		&export.FileName,
+		&export.Attempts,
+		(*NullTime)(&export.CreatedAt),
+		(*NullTime)(&export.UpdatedAt),
+		(*NullTime)(&export.ExpiresAt),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// Retrieves the most recent export matching where, which isn't escaped.
+//
+// Returns ENotFound if no export matches.
+func findDataExport(ctx context.Context, tx *Tx, where string, args ...any) (*goChat.DataExport, error) {
+	const op = "findDataExport"
+
+	query := `
+		SELECT ` + dataExportColumns + ` FROM data_exports
+		WHERE ` + where + `
+		ORDER BY id DESC
+		LIMIT 1
+	`
+	export, err := scanDataExport(tx.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return nil, goChat.NewNotFoundErr(fmt.Sprintf("where: %s, args: %v", where, args), op, "Export not found.", nil)
+	} else if err != nil {
+		return nil, goChat.NewInternalErr("querying data_exports", op, "", err)
+	}
+	return export, nil
+}
@@ -0,0 +1,77 @@
+package sqlite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adamni21/goChat"
+)
+
+// an export whose worker stopped is taken over once it times out
+func TestDataExportTakeover(t *testing.T) {
+	db := NewDB(":memory:")
+	if err := db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	user := &goChat.User{Username: "alice", Email: "alice@mail.io"}
+	if err := NewUserService(db).Create(ctx, user, "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	s := NewDataExportService(db, dir)
+	if _, err := s.RequestExport(ctx, user.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first worker claims the export and stops while writing its archive
+	stale, err := s.claimNextExport(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stalePath := filepath.Join(dir, "export-1-stale.zip")
+	if err := os.WriteFile(stalePath, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.PruneExpiredExports(ctx); err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(stalePath); err != nil {
+		t.Fatalf("expected archive of running export to be kept got %v", err)
+	}
+	if processed, err := s.ProcessNextExport(ctx); err != nil || processed {
+		t.Fatalf("expected running export not to be taken over yet got %t %v", processed, err)
+	}
+
+	now := db.Now().Add(s.RunningTimeout)
+	db.Now = func() time.Time { return now }
+	if processed, err := s.ProcessNextExport(ctx); err != nil || !processed {
+		t.Fatalf("expected export to be taken over got %t %v", processed, err)
+	}
+	export, err := s.FindExport(ctx, user.Id)
+	if err != nil {
+		t.Fatal(err)
+	} else if export.Status != goChat.ExportDone || export.Attempts != 2 {
+		t.Fatalf("unexpected export %+v", export)
+	}
+
+	// the first worker can't overwrite the finished export
+	err = s.updateExport(ctx, stale, goChat.ExportFailed, "", time.Time{})
+	if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EConflict {
+		t.Fatalf("expected EConflict error got %v", err)
+	}
+
+	if _, err := s.PruneExpiredExports(ctx); err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(stalePath); !os.IsNotExist(err) {
+		t.Fatalf("expected stale archive to be removed got %v", err)
+	} else if _, err := os.Stat(filepath.Join(dir, export.FileName)); err != nil {
+		t.Fatal(err)
+	}
+}
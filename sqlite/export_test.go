@@ -0,0 +1,126 @@
+package sqlite_test
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adamni21/goChat"
+	"github.com/adamni21/goChat/inmem"
+	"github.com/adamni21/goChat/sqlite"
+)
+
+func TestDataExport(t *testing.T) {
+	db := MustOpenDB(t)
+	defer MustCloseDB(t, db)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	s := sqlite.NewDataExportService(db, dir)
+	userService := sqlite.NewUserService(db)
+	alice := MustCreateUser(t, ctx, userService, &goChat.User{Username: "alice", Email: "alice@mail.io"}, "password")
+	bob := MustCreateUser(t, ctx, userService, &goChat.User{Username: "bob", Email: "bob@mail.io"}, "password")
+	MustBeContacts(t, ctx, sqlite.NewContactService(db), alice.Id, bob.Id)
+	if err := sqlite.NewEmailChangeService(db, inmem.NewMailer()).RequestEmailChange(ctx, alice.Id, "new@mail.io"); err != nil {
+		t.Fatal(err)
+	}
+
+	export, err := s.RequestExport(ctx, alice.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if export.Status != goChat.ExportPending {
+		t.Fatalf("Status=%s, want %s", export.Status, goChat.ExportPending)
+	}
+
+	// a pending export is reused
+	if again, err := s.RequestExport(ctx, alice.Id); err != nil {
+		t.Fatal(err)
+	} else if again.Id != export.Id {
+		t.Fatalf("Id=%d, want %d", again.Id, export.Id)
+	}
+
+	t.Run("process export", func(t *testing.T) {
+		if processed, err := s.ProcessNextExport(ctx); err != nil {
+			t.Fatal(err)
+		} else if !processed {
+			t.Fatal("expected export to be processed")
+		}
+		if processed, err := s.ProcessNextExport(ctx); err != nil || processed {
+			t.Fatalf("expected no pending export got %t %v", processed, err)
+		}
+
+		export, err := s.FindExport(ctx, alice.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if export.Status != goChat.ExportDone || export.Progress != 100 || export.ExpiresAt.IsZero() {
+			t.Fatalf("unexpected export %+v", export)
+		}
+
+		r, err := zip.OpenReader(filepath.Join(dir, export.FileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		files := make(map[string]*zip.File)
+		for _, f := range r.File {
+			files[f.Name] = f
+		}
+		for _, name := range []string{"user.json", "sessions.json", "contacts.json", "contact_requests.json", "blocks.json", "preferences.json", "suspensions.json", "email_changes.json"} {
+			if files[name] == nil {
+				t.Fatalf("archive is missing %s", name)
+			}
+		}
+
+		f, err := files["user.json"].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		var user struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(f).Decode(&user); err != nil {
+			t.Fatal(err)
+		} else if user.Email != alice.Email {
+			t.Fatalf("email=%s, want %s", user.Email, alice.Email)
+		}
+
+		// tokens are left out
+		f, err = files["email_changes.json"].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		var changes []map[string]any
+		if err := json.NewDecoder(f).Decode(&changes); err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 1 || changes[0]["newEmail"] != "new@mail.io" || len(changes[0]) != 4 {
+			t.Fatalf("unexpected email changes %v", changes)
+		}
+	})
+
+	t.Run("prune expired export", func(t *testing.T) {
+		export, err := s.FindExport(ctx, alice.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db.Now = func() time.Time { return export.ExpiresAt }
+		if n, err := s.PruneExpiredExports(ctx); err != nil {
+			t.Fatal(err)
+		} else if n != 1 {
+			t.Fatalf("pruned %d exports, want 1", n)
+		}
+		if _, err := os.Stat(filepath.Join(dir, export.FileName)); !os.IsNotExist(err) {
+			t.Fatalf("expected archive to be removed got %v", err)
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package sqlite
+
+import (
+	"context"
+	"sync"
+
+	"github.com/adamni21/goChat"
+)
+
+// mailQueue delivers mails in the background, so callers neither wait for
+// delivery nor learn whether it failed.
+type mailQueue struct {
+	mailer goChat.Mailer
+	wg     sync.WaitGroup
+}
+
+// Starts delivering mail and returns immediately. Delivery errors are
+// passed to onErr, which may be nil.
+func (q *mailQueue) enqueue(mail goChat.Mail, onErr func(error)) {
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		if err := q.mailer.Send(context.Background(), mail); err != nil && onErr != nil {
+			onErr(err)
+		}
+	}()
+}
+
+// Blocks until all enqueued mails are delivered or failed.
+func (q *mailQueue) wait() {
+	q.wg.Wait()
+}
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS users_username_lower_idx ON users (lower(username));
+CREATE INDEX IF NOT EXISTS users_createdAt_idx ON users (createdAt);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS verification_tokens (
+    tokenHash TEXT NOT NULL PRIMARY KEY,
+    userId INTEGER NOT NULL REFERENCES users (id),
+    expiry TEXT NOT NULL,
+    createdAt TEXT NOT NULL
+) STRICT
@@ -0,0 +1,5 @@
+-- username_skeleton is registered by the driver, see driverName
+ALTER TABLE users ADD COLUMN usernameSkeleton TEXT;
+UPDATE users SET usernameSkeleton = username_skeleton(username), email = lower(email);
+CREATE UNIQUE INDEX IF NOT EXISTS users_usernameSkeleton_idx ON users (usernameSkeleton);
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_idx ON users (lower(email));
@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN displayName TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN avatarRef TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN pronouns TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN status TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN statusExpiry TEXT;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS blocks (
+    blockerId INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    blockedId INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    createdAt TEXT NOT NULL,
+    PRIMARY KEY (blockerId, blockedId)
+) STRICT;
+CREATE INDEX IF NOT EXISTS blocks_blockedId_idx ON blocks (blockedId);
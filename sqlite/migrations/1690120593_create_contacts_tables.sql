@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS contact_requests (
+    id INTEGER NOT NULL PRIMARY KEY,
+    senderId INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    recipientId INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    state TEXT NOT NULL CHECK (state IN ('pending', 'accepted', 'declined', 'canceled')),
+    createdAt TEXT NOT NULL,
+    updatedAt TEXT NOT NULL
+) STRICT;
+-- at most one pending request per pair of users, regardless of direction
+CREATE UNIQUE INDEX IF NOT EXISTS contact_requests_pending_pair_idx
+    ON contact_requests (min(senderId, recipientId), max(senderId, recipientId))
+    WHERE state = 'pending';
+CREATE INDEX IF NOT EXISTS contact_requests_recipientId_idx ON contact_requests (recipientId);
+
+CREATE TABLE IF NOT EXISTS contacts (
+    userId INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    contactId INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    nickname TEXT NOT NULL DEFAULT '',
+    createdAt TEXT NOT NULL,
+    PRIMARY KEY (userId, contactId)
+) STRICT;
+
+ALTER TABLE users ADD COLUMN dmContactsOnly INTEGER NOT NULL DEFAULT 0;
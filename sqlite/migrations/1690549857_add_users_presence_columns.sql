@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN lastSeenAt TEXT;
+ALTER TABLE users ADD COLUMN presenceAudience TEXT NOT NULL DEFAULT 'everyone'
+    CHECK (presenceAudience IN ('everyone', 'contacts', 'nobody'));
+ALTER TABLE users ADD COLUMN lastSeenAudience TEXT NOT NULL DEFAULT 'everyone'
+    CHECK (lastSeenAudience IN ('everyone', 'contacts', 'nobody'));
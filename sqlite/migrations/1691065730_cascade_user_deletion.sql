@@ -0,0 +1,33 @@
+CREATE TABLE sessions_new (
+    id TEXT NOT NULL UNIQUE,
+    userId INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expiry TEXT NOT NULL
+) STRICT;
+INSERT INTO sessions_new (id, userId, expiry) SELECT id, userId, expiry FROM sessions;
+DROP TABLE sessions;
+ALTER TABLE sessions_new RENAME TO sessions;
+CREATE INDEX IF NOT EXISTS sessions_userId_idx ON sessions (userId);
+
+CREATE TABLE verification_tokens_new (
+    tokenHash TEXT NOT NULL PRIMARY KEY,
+    userId INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expiry TEXT NOT NULL,
+    createdAt TEXT NOT NULL
+) STRICT;
+INSERT INTO verification_tokens_new SELECT tokenHash, userId, expiry, createdAt FROM verification_tokens;
+DROP TABLE verification_tokens;
+ALTER TABLE verification_tokens_new RENAME TO verification_tokens;
+
+CREATE TABLE password_reset_tokens_new (
+    tokenHash TEXT NOT NULL PRIMARY KEY,
+    userId INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expiry TEXT NOT NULL,
+    createdAt TEXT NOT NULL
+) STRICT;
+INSERT INTO password_reset_tokens_new SELECT tokenHash, userId, expiry, createdAt FROM password_reset_tokens;
+DROP TABLE password_reset_tokens;
+ALTER TABLE password_reset_tokens_new RENAME TO password_reset_tokens;
+
+ALTER TABLE users ADD COLUMN deletionScheduledAt TEXT;
+CREATE INDEX IF NOT EXISTS users_deletionScheduledAt_idx ON users (deletionScheduledAt)
+    WHERE deletionScheduledAt IS NOT NULL;
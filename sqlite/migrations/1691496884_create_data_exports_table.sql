@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS data_exports (
+    id INTEGER NOT NULL PRIMARY KEY,
+    userId INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    status TEXT NOT NULL CHECK (status IN ('pending', 'running', 'done', 'failed')),
+    progress INTEGER NOT NULL DEFAULT 0,
+    fileName TEXT NOT NULL DEFAULT '',
+    createdAt TEXT NOT NULL,
+    updatedAt TEXT NOT NULL,
+    expiresAt TEXT
+) STRICT;
+CREATE INDEX IF NOT EXISTS data_exports_userId_idx ON data_exports (userId);
+CREATE INDEX IF NOT EXISTS data_exports_status_idx ON data_exports (status);
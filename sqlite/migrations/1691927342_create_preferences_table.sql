@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS preferences (
+    userId INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    updatedAt TEXT NOT NULL,
+    PRIMARY KEY (userId, key)
+) STRICT;
+CREATE INDEX IF NOT EXISTS preferences_userId_version_idx ON preferences (userId, version);
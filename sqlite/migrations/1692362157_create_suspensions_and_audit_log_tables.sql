@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS suspensions (
+    id INTEGER NOT NULL PRIMARY KEY,
+    userId INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    createdBy INTEGER NOT NULL DEFAULT 0,
+    createdAt TEXT NOT NULL,
+    expiresAt TEXT,
+    liftedAt TEXT,
+    liftedBy INTEGER NOT NULL DEFAULT 0
+) STRICT;
+CREATE INDEX IF NOT EXISTS suspensions_userId_idx ON suspensions (userId);
+
+-- no foreign keys, entries outlive the users they mention, 0 is the system
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER NOT NULL PRIMARY KEY,
+    actorId INTEGER NOT NULL DEFAULT 0,
+    action TEXT NOT NULL,
+    targetUserId INTEGER NOT NULL DEFAULT 0,
+    detail TEXT NOT NULL DEFAULT '',
+    createdAt TEXT NOT NULL
+) STRICT;
+CREATE INDEX IF NOT EXISTS audit_log_actorId_idx ON audit_log (actorId);
+CREATE INDEX IF NOT EXISTS audit_log_targetUserId_idx ON audit_log (targetUserId);
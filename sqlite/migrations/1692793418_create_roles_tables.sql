@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS roles (
+    id INTEGER NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+) STRICT;
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    roleId INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission TEXT NOT NULL,
+    PRIMARY KEY (roleId, permission)
+) STRICT;
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    userId INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    roleId INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    -- 0 if assigned by the system
+    assignedBy INTEGER NOT NULL DEFAULT 0,
+    createdAt TEXT NOT NULL,
+    PRIMARY KEY (userId, roleId)
+) STRICT;
+CREATE INDEX IF NOT EXISTS user_roles_roleId_idx ON user_roles (roleId);
+
+INSERT INTO roles (name) VALUES ('admin'), ('moderator');
+INSERT INTO role_permissions (roleId, permission)
+SELECT id, permission FROM roles, (
+    SELECT 'users.manage' AS permission
+    UNION ALL SELECT 'roles.manage'
+    UNION ALL SELECT 'content.moderate'
+    UNION ALL SELECT 'audit_log.view'
+) WHERE name = 'admin';
+INSERT INTO role_permissions (roleId, permission)
+SELECT id, 'content.moderate' FROM roles WHERE name = 'moderator';
@@ -0,0 +1,14 @@
+-- newEmail isn't unique, uniqueness is enforced by users.email on confirmation
+CREATE TABLE IF NOT EXISTS email_changes (
+    id INTEGER NOT NULL PRIMARY KEY,
+    userId INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    oldEmail TEXT NOT NULL,
+    newEmail TEXT NOT NULL,
+    confirmTokenHash TEXT NOT NULL UNIQUE,
+    confirmExpiry TEXT NOT NULL,
+    revertTokenHash TEXT UNIQUE,
+    revertExpiry TEXT,
+    createdAt TEXT NOT NULL,
+    confirmedAt TEXT
+) STRICT;
+CREATE INDEX IF NOT EXISTS email_changes_userId_idx ON email_changes (userId);
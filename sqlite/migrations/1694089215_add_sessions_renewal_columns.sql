@@ -0,0 +1,4 @@
+ALTER TABLE sessions ADD COLUMN maxExpiry TEXT;
+ALTER TABLE sessions ADD COLUMN renewedAt TEXT;
+-- existing sessions keep their fixed expiry
+UPDATE sessions SET maxExpiry = expiry;
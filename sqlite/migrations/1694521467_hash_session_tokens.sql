@@ -0,0 +1,3 @@
+-- hash_token is registered by the driver, see driverName
+ALTER TABLE sessions RENAME COLUMN id TO tokenHash;
+UPDATE sessions SET tokenHash = hash_token(tokenHash);
@@ -0,0 +1,3 @@
+-- skeletons used to be backfilled with lower(username), which differs from
+-- goChat.UsernameSkeleton for confusable characters
+UPDATE users SET usernameSkeleton = username_skeleton(username);
@@ -0,0 +1,5 @@
+-- lower() only folds ASCII, so prefix searches missed non-ASCII usernames
+ALTER TABLE users ADD COLUMN usernameLower TEXT;
+UPDATE users SET usernameLower = lower_unicode(username);
+DROP INDEX IF EXISTS users_username_lower_idx;
+CREATE INDEX IF NOT EXISTS users_usernameLower_idx ON users (usernameLower);
@@ -0,0 +1 @@
+ALTER TABLE data_exports ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
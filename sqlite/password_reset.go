@@ -0,0 +1,149 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/adamni21/goChat"
+	"github.com/adamni21/goChat/crypto"
+)
+
+const passwordResetServiceOp = "sqlite.PasswordResetService."
+
+// PasswordResetService represents a service for resetting forgotten passwords.
+type PasswordResetService struct {
+	db       *DB
+	mails    *mailQueue
+	pwHasher crypto.PasswordHasher
+
+	// How long an issued token stays valid.
+	TokenLifetime time.Duration
+	// Receives errors of reset mails, which are delivered in the
+	// background. May be nil.
+	OnMailErr func(error)
+}
+
+// returns new instance of PasswordResetService
+func NewPasswordResetService(db *DB, mailer goChat.Mailer) *PasswordResetService {
+	return &PasswordResetService{
+		db:            db,
+		mails:         &mailQueue{mailer: mailer},
+		pwHasher:      crypto.NewArgon2Hasher(),
+		TokenLifetime: time.Hour,
+	}
+}
+
+// Mails a single-use reset token to email if a user with that email exists.
+// Known and unknown emails cost the same work and the mail is delivered in
+// the background, see OnMailErr.
+//
+// Returns nil whether or not email is registered or delivery fails, so
+// callers can't find out which addresses have an account.
+func (s *PasswordResetService) RequestReset(ctx context.Context, email string) error {
+	const op = passwordResetServiceOp + "RequestReset"
+
+	if normalized, err := goChat.NormalizeEmail(email); err == nil {
+		email = normalized
+	}
+	token, err := crypto.GenerateToken()
+	if err != nil {
+		return goChat.NewInternalErr("generating token", op, "", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	expiry := tx.now.Add(s.TokenLifetime)
+
+	// a single statement inserting no row for unknown emails, so both cases take the same path
+	query := `
+		INSERT INTO password_reset_tokens (tokenHash, userId, expiry, createdAt)
+		SELECT ?, id, ?, ? FROM users
+		WHERE email = ?
+	`
+	result, err := tx.ExecContext(ctx, query, crypto.HashToken(token), (*NullTime)(&expiry), (*NullTime)(&tx.now), email)
+	if err != nil {
+		return goChat.NewInternalErr("inserting into password_reset_tokens table", op, "", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return goChat.NewInternalErr("getting rows affected", op, "", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	if n > 0 {
+		s.mails.enqueue(goChat.Mail{
+			To:      email,
+			Subject: "Reset your password",
+			Body:    fmt.Sprintf("Use this code to reset your password:\n\n%s\n\nThe code expires at %s. If you didn't request a reset, you can ignore this mail.", token, expiry.Format(time.RFC1123)),
+		}, s.OnMailErr)
+	}
+
+	return nil
+}
+
+// Blocks until all reset mails sent so far are delivered or failed.
+// Call it before shutting down.
+func (s *PasswordResetService) Wait() {
+	s.mails.wait()
+}
+
+// Sets the password of the user the token was issued for, invalidates
+// the token and deletes all sessions of the user.
+//
+// Returns ENotFound if token doesn't exist or has expired.
+// Returns EInvalid if newPassword violates the password policy.
+func (s *PasswordResetService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	const op = passwordResetServiceOp + "ResetPassword"
+
+	if err := goChat.ValidatePassword(newPassword); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+	passwordDigest, err := s.pwHasher.Generate(newPassword)
+	if err != nil {
+		return goChat.NewInternalErr("generating password hash", op, "", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	var userId goChat.Id
+	var expiry time.Time
+	query := `
+		SELECT userId, expiry FROM password_reset_tokens
+		WHERE tokenHash = ?
+	`
+	err = tx.QueryRowContext(ctx, query, crypto.HashToken(token)).Scan(&userId, (*NullTime)(&expiry))
+	if err == sql.ErrNoRows || (err == nil && !tx.now.Before(expiry)) {
+		return goChat.NewNotFoundErr("", op, "Invalid or expired reset code.", nil)
+	} else if err != nil {
+		return goChat.NewInternalErr("querying password reset token", op, "", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM password_reset_tokens WHERE userId = ?", userId); err != nil {
+		return goChat.NewInternalErr("deleting password reset tokens", op, "", err)
+	}
+	if err = updatePasswordDigest(ctx, tx, userId, passwordDigest); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+	if err = deleteUserSessions(ctx, tx, userId, ""); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adamni21/goChat"
+	"github.com/adamni21/goChat/inmem"
+	"github.com/adamni21/goChat/sqlite"
+)
+
+func TestPasswordReset(t *testing.T) {
+	db := MustOpenDB(t)
+	defer MustCloseDB(t, db)
+	ctx := context.Background()
+
+	mailer := inmem.NewMailer()
+	s := sqlite.NewPasswordResetService(db, mailer)
+	authService := sqlite.NewAuthService(db)
+	user := MustCreateUser(t, ctx, sqlite.NewUserService(db), &goChat.User{Username: "user0", Email: "test@mail.io"}, "password")
+	session := &goChat.Session{UserId: user.Id}
+	MustCreateSession(t, ctx, db, session)
+
+	// doesn't reveal whether email is registered
+	t.Run("unknown email", func(t *testing.T) {
+		if err := s.RequestReset(ctx, "unknown@mail.io"); err != nil {
+			t.Fatalf("expected no error got %+v", err)
+		}
+		s.Wait()
+		if len(mailer.Mails()) != 0 {
+			t.Fatalf("expected no mail got %+v", mailer.Mails())
+		}
+	})
+
+	if err := s.RequestReset(ctx, user.Email); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	mail, ok := mailer.LastMailTo(user.Email)
+	if !ok {
+		t.Fatal("expected reset mail")
+	}
+	token := TokenFromMail(t, mail)
+
+	// return EInvalid if new password violates policy
+	t.Run("new password too short", func(t *testing.T) {
+		err := s.ResetPassword(ctx, token, "short")
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EInvalid {
+			t.Fatalf("expected EInvalid got %+v", err)
+		}
+	})
+
+	t.Run("reset successfully", func(t *testing.T) {
+		if err := s.ResetPassword(ctx, token, "newPassword"); err != nil {
+			t.Fatal(err)
+		}
+
+		if ok, err := authService.VerifyUser(ctx, *user, "newPassword"); err != nil || !ok {
+			t.Fatalf("expected new password to be valid, got %t %+v", ok, err)
+		}
+		if ok, err := authService.VerifyUser(ctx, *user, "password"); err != nil || ok {
+			t.Fatalf("expected old password to be invalid, got %t %+v", ok, err)
+		}
+
+		_, err := authService.FindSession(ctx, session.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected sessions to be revoked got %+v", err)
+		}
+	})
+
+	// token is single-use
+	t.Run("reuse token", func(t *testing.T) {
+		err := s.ResetPassword(ctx, token, "otherPassword")
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		}
+	})
+}
+
+// delivery errors aren't returned, they'd reveal that the email is registered
+func TestPasswordResetMailFails(t *testing.T) {
+	db := MustOpenDB(t)
+	defer MustCloseDB(t, db)
+	ctx := context.Background()
+
+	s := sqlite.NewPasswordResetService(db, failingMailer{})
+	var mailErr error
+	s.OnMailErr = func(err error) { mailErr = err }
+	user := MustCreateUser(t, ctx, sqlite.NewUserService(db), &goChat.User{Username: "user0", Email: "test@mail.io"}, "password")
+
+	if err := s.RequestReset(ctx, user.Email); err != nil {
+		t.Fatalf("expected no error got %+v", err)
+	}
+	s.Wait()
+	if mailErr == nil {
+		t.Fatal("expected delivery error to be reported to OnMailErr")
+	}
+}
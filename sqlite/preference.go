@@ -0,0 +1,249 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/adamni21/goChat"
+	"github.com/mattn/go-sqlite3"
+)
+
+const preferenceServiceOp = "sqlite.PreferenceService."
+
+// PreferenceService stores per-user values of the preferences registered
+// with goChat.RegisterPreference.
+type PreferenceService struct {
+	db *DB
+}
+
+// returns new instance of PreferenceService
+func NewPreferenceService(db *DB) *PreferenceService {
+	return &PreferenceService{db: db}
+}
+
+// Retrieves the value of every registered preference of userId,
+// defaults included.
+func (s *PreferenceService) FindPreferences(ctx context.Context, userId goChat.Id) ([]*goChat.PreferenceValue, error) {
+	const op = preferenceServiceOp + "FindPreferences"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	stored, err := findPreferenceValues(ctx, tx, userId, 0)
+	if err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+	byKey := make(map[string]*goChat.PreferenceValue, len(stored))
+	for _, v := range stored {
+		byKey[v.Key] = v
+	}
+
+	schemas := goChat.Preferences()
+	values := make([]*goChat.PreferenceValue, 0, len(schemas))
+	for _, schema := range schemas {
+		values = append(values, valueOrDefault(schema, byKey[schema.Key]))
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Key < values[j].Key })
+
+	return values, nil
+}
+
+// Retrieves the value of a single preference of userId.
+//
+// Returns EInvalid if no preference is registered with key.
+func (s *PreferenceService) FindPreference(ctx context.Context, userId goChat.Id, key string) (*goChat.PreferenceValue, error) {
+	const op = preferenceServiceOp + "FindPreference"
+
+	schema, ok := goChat.LookupPreference(key)
+	if !ok {
+		return nil, goChat.NewInvalidFieldErr("key", fmt.Sprintf("key: %s", key), op, "Unknown preference.", nil)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	value, err := findPreferenceValue(ctx, tx, userId, key)
+	if err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+	return valueOrDefault(schema, value), nil
+}
+
+// Retrieves the preferences of userId changed after sinceVersion and
+// the current version, which a device passes as sinceVersion next time.
+func (s *PreferenceService) FindPreferenceChanges(ctx context.Context, userId goChat.Id, sinceVersion int64) ([]*goChat.PreferenceValue, int64, error) {
+	const op = preferenceServiceOp + "FindPreferenceChanges"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	values, err := findPreferenceValues(ctx, tx, userId, sinceVersion)
+	if err != nil {
+		return nil, 0, goChat.Error{Op: op, Err: err}
+	}
+	version, err := currentPreferenceVersion(ctx, tx, userId)
+	if err != nil {
+		return nil, 0, goChat.Error{Op: op, Err: err}
+	}
+
+	return values, version, nil
+}
+
+// Validates and stores a preference value and bumps the user's version.
+//
+// Returns ENotFound if user doesn't exist.
+// Returns EInvalid if key isn't registered or the value doesn't match its schema.
+// Returns EConflict if upd.BaseVersion is set and the value changed since.
+func (s *PreferenceService) SetPreference(ctx context.Context, userId goChat.Id, upd goChat.PreferenceUpdate) (*goChat.PreferenceValue, error) {
+	const op = preferenceServiceOp + "SetPreference"
+	info := fmt.Sprintf("userId: %d, key: %s", userId, upd.Key)
+
+	schema, ok := goChat.LookupPreference(upd.Key)
+	if !ok {
+		return nil, goChat.NewInvalidFieldErr("key", info, op, "Unknown preference.", nil)
+	}
+	// stored re-encoded, so a value is returned the way the schema reads it
+	normalized, err := schema.Normalize(upd.Value)
+	if err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	if upd.BaseVersion != nil {
+		current, err := findPreferenceValue(ctx, tx, userId, upd.Key)
+		if err != nil {
+			return nil, goChat.Error{Op: op, Err: err}
+		}
+		var currentVersion int64
+		if current != nil {
+			currentVersion = current.Version
+		}
+		if currentVersion != *upd.BaseVersion {
+			return nil, goChat.NewConflictErr(info, op, "Preference was changed on another device.", nil)
+		}
+	}
+
+	version, err := currentPreferenceVersion(ctx, tx, userId)
+	if err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+	value := &goChat.PreferenceValue{
+		Key:       upd.Key,
+		Value:     normalized,
+		Version:   version + 1,
+		UpdatedAt: tx.now,
+	}
+
+	query := `
+		INSERT INTO preferences (userId, key, value, version, updatedAt)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (userId, key) DO UPDATE
+		SET value = excluded.value, version = excluded.version, updatedAt = excluded.updatedAt
+	`
+	_, err = tx.ExecContext(ctx, query, userId, value.Key, string(value.Value), value.Version, (*NullTime)(&value.UpdatedAt))
+	if err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey {
+			return nil, goChat.NewNotFoundErr(info, op, "User not found.", nil)
+		}
+		return nil, goChat.NewInternalErr("upserting into preferences table", op, "", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return value, nil
+}
+
+func valueOrDefault(schema goChat.PreferenceSchema, value *goChat.PreferenceValue) *goChat.PreferenceValue {
+	if value != nil {
+		return value
+	}
+	return &goChat.PreferenceValue{Key: schema.Key, Value: schema.Default}
+}
+
+// Retrieves the stored preferences of userId with a version greater than
+// sinceVersion, ordered by version.
+func findPreferenceValues(ctx context.Context, tx *Tx, userId goChat.Id, sinceVersion int64) ([]*goChat.PreferenceValue, error) {
+	const op = "findPreferenceValues"
+
+	query := `
+		SELECT key, value, version, updatedAt FROM preferences
+		WHERE userId = ? AND version > ?
+		ORDER BY version
+	`
+	rows, err := tx.QueryContext(ctx, query, userId, sinceVersion)
+	if err != nil {
+		return nil, goChat.NewInternalErr("querying preferences", op, "", err)
+	}
+	defer rows.Close()
+
+	values := make([]*goChat.PreferenceValue, 0)
+	for rows.Next() {
+		value, err := scanPreferenceValue(rows)
+		if err != nil {
+			return nil, goChat.NewInternalErr("scanning row", op, "", err)
+		}
+		values = append(values, value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, goChat.NewInternalErr("iterating rows", op, "", err)
+	}
+
+	return values, nil
+}
+
+// Retrieves a stored preference, nil if userId hasn't set it.
+func findPreferenceValue(ctx context.Context, tx *Tx, userId goChat.Id, key string) (*goChat.PreferenceValue, error) {
+	const op = "findPreferenceValue"
+
+	query := `
+		SELECT key, value, version, updatedAt FROM preferences
+		WHERE userId = ? AND key = ?
+	`
+	value, err := scanPreferenceValue(tx.QueryRowContext(ctx, query, userId, key))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, goChat.NewInternalErr("querying preference", op, "", err)
+	}
+	return value, nil
+}
+
+func currentPreferenceVersion(ctx context.Context, tx *Tx, userId goChat.Id) (int64, error) {
+	const op = "currentPreferenceVersion"
+
+	var version int64
+	err := tx.QueryRowContext(ctx, "SELECT coalesce(max(version), 0) FROM preferences WHERE userId = ?", userId).Scan(&version)
+	if err != nil {
+		return 0, goChat.NewInternalErr("querying preference version", op, "", err)
+	}
+	return version, nil
+}
+
+func scanPreferenceValue(row interface{ Scan(...any) error }) (*goChat.PreferenceValue, error) {
+	value := &goChat.PreferenceValue{}
+	var raw string
+	if err := row.Scan(&value.Key, &raw, &value.Version, (*NullTime)(&value.UpdatedAt)); err != nil {
+		return nil, err
+	}
+	value.Value = json.RawMessage(raw)
+	return value, nil
+}
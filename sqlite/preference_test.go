@@ -0,0 +1,124 @@
+package sqlite_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/adamni21/goChat"
+	"github.com/adamni21/goChat/sqlite"
+)
+
+func TestPreferences(t *testing.T) {
+	db := MustOpenDB(t)
+	defer MustCloseDB(t, db)
+	ctx := context.Background()
+
+	s := sqlite.NewPreferenceService(db)
+	user := MustCreateUser(t, ctx, sqlite.NewUserService(db), &goChat.User{Username: "user0", Email: "test@mail.io"}, "password")
+
+	t.Run("defaults", func(t *testing.T) {
+		theme, err := goChat.PrefTheme.Get(ctx, s, user.Id)
+		if err != nil {
+			t.Fatal(err)
+		} else if theme != goChat.PrefTheme.Default {
+			t.Fatalf("theme=%s, want %s", theme, goChat.PrefTheme.Default)
+		}
+
+		values, err := s.FindPreferences(ctx, user.Id)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(values) != len(goChat.Preferences()) {
+			t.Fatalf("len(values)=%d, want %d", len(values), len(goChat.Preferences()))
+		}
+	})
+
+	t.Run("set typed preference", func(t *testing.T) {
+		if _, err := goChat.PrefTheme.Set(ctx, s, user.Id, "dark"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := goChat.PrefNotificationSound.Set(ctx, s, user.Id, false); err != nil {
+			t.Fatal(err)
+		}
+
+		if theme, err := goChat.PrefTheme.Get(ctx, s, user.Id); err != nil {
+			t.Fatal(err)
+		} else if theme != "dark" {
+			t.Fatalf("theme=%s, want %s", theme, "dark")
+		}
+		if sound, err := goChat.PrefNotificationSound.Get(ctx, s, user.Id); err != nil {
+			t.Fatal(err)
+		} else if sound {
+			t.Fatal("expected notification sound to be disabled")
+		}
+	})
+
+	// return EInvalid if value doesn't match schema
+	t.Run("invalid value", func(t *testing.T) {
+		_, err := goChat.PrefTheme.Set(ctx, s, user.Id, "pink")
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EInvalid {
+			t.Fatalf("expected EInvalid got %+v", err)
+		}
+		_, err = s.SetPreference(ctx, user.Id, goChat.PreferenceUpdate{Key: "timeZone", Value: json.RawMessage(`42`)})
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EInvalid {
+			t.Fatalf("expected EInvalid got %+v", err)
+		}
+		// null would unmarshal into false without an error
+		_, err = s.SetPreference(ctx, user.Id, goChat.PreferenceUpdate{Key: "notifications.enabled", Value: json.RawMessage(` null `)})
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EInvalid {
+			t.Fatalf("expected EInvalid got %+v", err)
+		}
+	})
+
+	// return EInvalid if key isn't registered
+	t.Run("unknown key", func(t *testing.T) {
+		_, err := s.SetPreference(ctx, user.Id, goChat.PreferenceUpdate{Key: "unknown", Value: json.RawMessage(`true`)})
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EInvalid || val.ErrField() != "key" {
+			t.Fatalf("expected EInvalid for key got %+v", err)
+		}
+	})
+
+	t.Run("sync changes", func(t *testing.T) {
+		changes, version, err := s.FindPreferenceChanges(ctx, user.Id, 0)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(changes) != 2 || version != 2 {
+			t.Fatalf("got %d changes at version %d, want 2 at 2", len(changes), version)
+		}
+
+		if _, err := goChat.PrefLocale.Set(ctx, s, user.Id, "de-DE"); err != nil {
+			t.Fatal(err)
+		}
+		changes, version, err = s.FindPreferenceChanges(ctx, user.Id, version)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(changes) != 1 || changes[0].Key != goChat.PrefLocale.Key || version != 3 {
+			t.Fatalf("got changes %+v at version %d, want locale at 3", changes, version)
+		}
+	})
+
+	// return EConflict if value changed since BaseVersion
+	t.Run("stale base version", func(t *testing.T) {
+		stale := int64(0)
+		_, err := s.SetPreference(ctx, user.Id, goChat.PreferenceUpdate{Key: "theme", Value: json.RawMessage(`"light"`), BaseVersion: &stale})
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EConflict {
+			t.Fatalf("expected EConflict got %+v", err)
+		}
+	})
+
+	// the decoded value is stored, not the bytes sent
+	t.Run("normalized value", func(t *testing.T) {
+		value, err := s.SetPreference(ctx, user.Id, goChat.PreferenceUpdate{Key: "notifications.sound", Value: json.RawMessage(" false\n")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(value.Value) != "false" {
+			t.Fatalf("Value=%q, want %q", value.Value, "false")
+		}
+		if found, err := s.FindPreference(ctx, user.Id, "notifications.sound"); err != nil {
+			t.Fatal(err)
+		} else if string(found.Value) != "false" {
+			t.Fatalf("stored %q, want %q", found.Value, "false")
+		}
+	})
+}
@@ -0,0 +1,403 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/adamni21/goChat"
+)
+
+const presenceServiceOp = "sqlite.PresenceService."
+
+// PresenceService tracks presence in memory and only writes the last seen
+// time to the DB when a user goes offline, so heartbeats don't hit SQLite.
+type PresenceService struct {
+	db *DB
+
+	// Devices without a heartbeat for this long are considered disconnected.
+	Timeout time.Duration
+	// Buffer size of subscription channels.
+	SubscriptionBuffer int
+
+	mu sync.Mutex
+	// connected devices by user, users without devices are offline
+	devices     map[goChat.Id]map[string]device
+	subscribers map[goChat.Id]map[*presenceSubscription]struct{}
+}
+
+type device struct {
+	status        goChat.PresenceStatus
+	lastHeartbeat time.Time
+}
+
+type presenceSubscription struct {
+	ch         chan goChat.Presence
+	visibility map[goChat.Id]presenceVisibility
+}
+
+type presenceVisibility struct {
+	presence bool
+	lastSeen bool
+}
+
+// returns new instance of PresenceService
+func NewPresenceService(db *DB) *PresenceService {
+	return &PresenceService{
+		db:                 db,
+		Timeout:            time.Minute,
+		SubscriptionBuffer: 16,
+		devices:            make(map[goChat.Id]map[string]device),
+		subscribers:        make(map[goChat.Id]map[*presenceSubscription]struct{}),
+	}
+}
+
+// Records a heartbeat of a device of userId. status must be PresenceOnline
+// or PresenceAway. A user is online if any device is online, away if all
+// connected devices are away and offline otherwise.
+//
+// Returns EInvalid if status isn't online or away.
+func (s *PresenceService) Heartbeat(ctx context.Context, userId goChat.Id, deviceId string, status goChat.PresenceStatus) error {
+	const op = presenceServiceOp + "Heartbeat"
+	if status != goChat.PresenceOnline && status != goChat.PresenceAway {
+		return goChat.NewInvalidErr(fmt.Sprintf("status: %s", status), op, "Invalid presence status.", nil)
+	}
+
+	now := s.db.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := s.status(userId)
+	if s.devices[userId] == nil {
+		s.devices[userId] = make(map[string]device)
+	}
+	s.devices[userId][deviceId] = device{status: status, lastHeartbeat: now}
+	if after := s.status(userId); after != before {
+		s.publish(goChat.Presence{UserId: userId, Status: after, LastSeen: now})
+	}
+
+	return nil
+}
+
+// Marks a device of userId as disconnected.
+func (s *PresenceService) Disconnect(ctx context.Context, userId goChat.Id, deviceId string) error {
+	const op = presenceServiceOp + "Disconnect"
+
+	now := s.db.Now()
+
+	s.mu.Lock()
+	if _, ok := s.devices[userId][deviceId]; !ok {
+		s.mu.Unlock()
+		return nil
+	}
+	before := s.status(userId)
+	delete(s.devices[userId], deviceId)
+	if len(s.devices[userId]) == 0 {
+		delete(s.devices, userId)
+	}
+	after := s.status(userId)
+	if after != before {
+		s.publish(goChat.Presence{UserId: userId, Status: after, LastSeen: now})
+	}
+	s.mu.Unlock()
+
+	if after == goChat.PresenceOffline {
+		if err := s.saveLastSeen(ctx, map[goChat.Id]time.Time{userId: now}); err != nil {
+			return goChat.Error{Op: op, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// Disconnects devices that haven't sent a heartbeat within Timeout and
+// persists the last seen time of users that went offline.
+func (s *PresenceService) Sweep(ctx context.Context) error {
+	const op = presenceServiceOp + "Sweep"
+
+	deadline := s.db.Now().Add(-s.Timeout)
+	wentOffline := make(map[goChat.Id]time.Time)
+
+	s.mu.Lock()
+	for userId, devices := range s.devices {
+		before := s.status(userId)
+		var lastHeartbeat time.Time
+		for deviceId, d := range devices {
+			if d.lastHeartbeat.After(lastHeartbeat) {
+				lastHeartbeat = d.lastHeartbeat
+			}
+			if d.lastHeartbeat.Before(deadline) {
+				delete(devices, deviceId)
+			}
+		}
+		if len(devices) == 0 {
+			delete(s.devices, userId)
+			wentOffline[userId] = lastHeartbeat
+		}
+		if after := s.status(userId); after != before {
+			s.publish(goChat.Presence{UserId: userId, Status: after, LastSeen: lastHeartbeat})
+		}
+	}
+	s.mu.Unlock()
+
+	if err := s.saveLastSeen(ctx, wentOffline); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+	return nil
+}
+
+// Calls Sweep every Timeout/2 until ctx is done.
+// Errors are passed to onErr, which may be nil.
+func (s *PresenceService) Run(ctx context.Context, onErr func(error)) {
+	ticker := time.NewTicker(s.Timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Sweep(ctx); err != nil && onErr != nil {
+				onErr(err)
+			}
+		}
+	}
+}
+
+// Retrieves the presence of userId as seen by viewerId.
+//
+// Returns ENotFound if user doesn't exist.
+func (s *PresenceService) FindPresence(ctx context.Context, viewerId, userId goChat.Id) (*goChat.Presence, error) {
+	const op = presenceServiceOp + "FindPresence"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	vis, lastSeen, err := findPresenceVisibility(ctx, tx, viewerId, userId)
+	if err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+
+	presence := &goChat.Presence{UserId: userId}
+	s.mu.Lock()
+	presence.Status = s.status(userId)
+	for _, d := range s.devices[userId] {
+		if d.lastHeartbeat.After(lastSeen) {
+			lastSeen = d.lastHeartbeat
+		}
+	}
+	s.mu.Unlock()
+
+	if !vis.presence {
+		presence.Status = ""
+	}
+	if vis.lastSeen {
+		presence.LastSeen = lastSeen
+	}
+
+	return presence, nil
+}
+
+// Sets who may see the presence and the last seen time of userId.
+//
+// Returns ENotFound if user doesn't exist.
+// Returns EInvalid if an audience isn't valid.
+func (s *PresenceService) SetPresencePrivacy(ctx context.Context, userId goChat.Id, presence, lastSeen goChat.Audience) error {
+	const op = presenceServiceOp + "SetPresencePrivacy"
+	if !presence.Valid() || !lastSeen.Valid() {
+		return goChat.NewInvalidErr(fmt.Sprintf("presence: %s, lastSeen: %s", presence, lastSeen), op, "Invalid audience.", nil)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE users
+		SET presenceAudience = ?, lastSeenAudience = ?
+		WHERE id = ?
+	`
+	result, err := tx.ExecContext(ctx, query, presence, lastSeen, userId)
+	if err != nil {
+		return goChat.NewInternalErr("updating users table", op, "", err)
+	}
+	if err = expectRowsAffected(result, op, "User not found."); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
+
+// Subscribes viewerId to presence changes of userIds. Visibility is
+// determined once when subscribing. Events are dropped if the channel's
+// buffer is full. Call the returned func to unsubscribe, the subscription
+// also ends when ctx is done.
+func (s *PresenceService) Subscribe(ctx context.Context, viewerId goChat.Id, userIds []goChat.Id) (<-chan goChat.Presence, func(), error) {
+	const op = presenceServiceOp + "Subscribe"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	sub := &presenceSubscription{
+		ch:         make(chan goChat.Presence, s.SubscriptionBuffer),
+		visibility: make(map[goChat.Id]presenceVisibility, len(userIds)),
+	}
+	for _, userId := range userIds {
+		vis, _, err := findPresenceVisibility(ctx, tx, viewerId, userId)
+		if err != nil {
+			return nil, nil, goChat.Error{Op: op, Err: err}
+		}
+		sub.visibility[userId] = vis
+	}
+
+	s.mu.Lock()
+	for userId := range sub.visibility {
+		if s.subscribers[userId] == nil {
+			s.subscribers[userId] = make(map[*presenceSubscription]struct{})
+		}
+		s.subscribers[userId][sub] = struct{}{}
+	}
+	s.mu.Unlock()
+
+	// closed by unsubscribe, so the goroutine below ends with it
+	done := make(chan struct{})
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			close(done)
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			for userId := range sub.visibility {
+				delete(s.subscribers[userId], sub)
+				if len(s.subscribers[userId]) == 0 {
+					delete(s.subscribers, userId)
+				}
+			}
+			close(sub.ch)
+		})
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			unsubscribe()
+		case <-done:
+		}
+	}()
+
+	return sub.ch, unsubscribe, nil
+}
+
+// Returns the aggregated status of userId. s.mu must be held.
+func (s *PresenceService) status(userId goChat.Id) goChat.PresenceStatus {
+	devices := s.devices[userId]
+	if len(devices) == 0 {
+		return goChat.PresenceOffline
+	}
+	for _, d := range devices {
+		if d.status == goChat.PresenceOnline {
+			return goChat.PresenceOnline
+		}
+	}
+	return goChat.PresenceAway
+}
+
+// Sends presence to subscribers allowed to see it. s.mu must be held.
+func (s *PresenceService) publish(presence goChat.Presence) {
+	for sub := range s.subscribers[presence.UserId] {
+		vis := sub.visibility[presence.UserId]
+		if !vis.presence {
+			continue
+		}
+		p := presence
+		if !vis.lastSeen {
+			p.LastSeen = time.Time{}
+		}
+		select {
+		case sub.ch <- p:
+		default:
+		}
+	}
+}
+
+func (s *PresenceService) saveLastSeen(ctx context.Context, lastSeen map[goChat.Id]time.Time) error {
+	const op = presenceServiceOp + "saveLastSeen"
+	if len(lastSeen) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	for userId, t := range lastSeen {
+		t := t.UTC().Truncate(time.Second)
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET lastSeenAt = ? WHERE id = ?", (*NullTime)(&t), userId); err != nil {
+			return goChat.NewInternalErr("updating users table", op, "", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
+
+// Determines what viewerId may see of the presence of userId and returns
+// the persisted last seen time of userId. Users always see their own
+// presence, blocked users never see each other's.
+//
+// Returns ENotFound if user doesn't exist.
+func findPresenceVisibility(ctx context.Context, tx *Tx, viewerId, userId goChat.Id) (presenceVisibility, time.Time, error) {
+	const op = "findPresenceVisibility"
+
+	var presenceAudience, lastSeenAudience goChat.Audience
+	var lastSeen time.Time
+	query := `
+		SELECT presenceAudience, lastSeenAudience, lastSeenAt FROM users
+		WHERE id = ?
+	`
+	err := tx.QueryRowContext(ctx, query, userId).Scan(&presenceAudience, &lastSeenAudience, (*NullTime)(&lastSeen))
+	if err == sql.ErrNoRows {
+		return presenceVisibility{}, time.Time{}, goChat.NewNotFoundErr(fmt.Sprintf("userId: %d", userId), op, "User not found.", nil)
+	} else if err != nil {
+		return presenceVisibility{}, time.Time{}, goChat.NewInternalErr("querying users", op, "", err)
+	}
+
+	if viewerId == userId {
+		return presenceVisibility{presence: true, lastSeen: true}, lastSeen, nil
+	}
+	if blocked, err := isBlocked(ctx, tx, viewerId, userId); err != nil {
+		return presenceVisibility{}, time.Time{}, goChat.Error{Op: op, Err: err}
+	} else if blocked {
+		return presenceVisibility{}, lastSeen, nil
+	}
+
+	var contact bool
+	if presenceAudience == goChat.AudienceContacts || lastSeenAudience == goChat.AudienceContacts {
+		if contact, err = isContact(ctx, tx, userId, viewerId); err != nil {
+			return presenceVisibility{}, time.Time{}, goChat.Error{Op: op, Err: err}
+		}
+	}
+	visibleTo := func(audience goChat.Audience) bool {
+		return audience == goChat.AudienceEveryone || (audience == goChat.AudienceContacts && contact)
+	}
+
+	return presenceVisibility{presence: visibleTo(presenceAudience), lastSeen: visibleTo(lastSeenAudience)}, lastSeen, nil
+}
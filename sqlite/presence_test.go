@@ -0,0 +1,181 @@
+package sqlite_test
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/adamni21/goChat"
+	"github.com/adamni21/goChat/sqlite"
+)
+
+func TestPresence(t *testing.T) {
+	db := MustOpenDB(t)
+	defer MustCloseDB(t, db)
+	ctx := context.Background()
+
+	now := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	db.Now = func() time.Time { return now }
+
+	s := sqlite.NewPresenceService(db)
+	userService := sqlite.NewUserService(db)
+	alice := MustCreateUser(t, ctx, userService, &goChat.User{Username: "alice", Email: "alice@mail.io"}, "password")
+	bob := MustCreateUser(t, ctx, userService, &goChat.User{Username: "bob", Email: "bob@mail.io"}, "password")
+
+	events, unsubscribe, err := s.Subscribe(ctx, bob.Id, []goChat.Id{alice.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+
+	assertStatus := func(t *testing.T, want goChat.PresenceStatus) {
+		t.Helper()
+		presence, err := s.FindPresence(ctx, bob.Id, alice.Id)
+		if err != nil {
+			t.Fatal(err)
+		} else if presence.Status != want {
+			t.Fatalf("Status=%s, want %s", presence.Status, want)
+		}
+	}
+	assertEvent := func(t *testing.T, want goChat.PresenceStatus) {
+		t.Helper()
+		select {
+		case p := <-events:
+			if p.Status != want {
+				t.Fatalf("event Status=%s, want %s", p.Status, want)
+			}
+		default:
+			t.Fatalf("expected %s event", want)
+		}
+	}
+
+	assertStatus(t, goChat.PresenceOffline)
+
+	t.Run("aggregate devices", func(t *testing.T) {
+		if err := s.Heartbeat(ctx, alice.Id, "phone", goChat.PresenceAway); err != nil {
+			t.Fatal(err)
+		}
+		assertStatus(t, goChat.PresenceAway)
+		assertEvent(t, goChat.PresenceAway)
+
+		if err := s.Heartbeat(ctx, alice.Id, "laptop", goChat.PresenceOnline); err != nil {
+			t.Fatal(err)
+		}
+		assertStatus(t, goChat.PresenceOnline)
+		assertEvent(t, goChat.PresenceOnline)
+
+		if err := s.Disconnect(ctx, alice.Id, "laptop"); err != nil {
+			t.Fatal(err)
+		}
+		assertStatus(t, goChat.PresenceAway)
+		assertEvent(t, goChat.PresenceAway)
+	})
+
+	t.Run("sweep stale devices", func(t *testing.T) {
+		lastHeartbeat := now
+		now = now.Add(2 * s.Timeout)
+		if err := s.Sweep(ctx); err != nil {
+			t.Fatal(err)
+		}
+		assertStatus(t, goChat.PresenceOffline)
+		assertEvent(t, goChat.PresenceOffline)
+
+		presence, err := s.FindPresence(ctx, bob.Id, alice.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !presence.LastSeen.Equal(lastHeartbeat) {
+			t.Fatalf("LastSeen=%v, want %v", presence.LastSeen, lastHeartbeat)
+		}
+	})
+
+	// return EInvalid for statuses other than online and away
+	t.Run("invalid status", func(t *testing.T) {
+		err := s.Heartbeat(ctx, alice.Id, "phone", goChat.PresenceOffline)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EInvalid {
+			t.Fatalf("expected EInvalid got %+v", err)
+		}
+	})
+}
+
+func TestPresencePrivacy(t *testing.T) {
+	db := MustOpenDB(t)
+	defer MustCloseDB(t, db)
+	ctx := context.Background()
+
+	s := sqlite.NewPresenceService(db)
+	contactService := sqlite.NewContactService(db)
+	userService := sqlite.NewUserService(db)
+	alice := MustCreateUser(t, ctx, userService, &goChat.User{Username: "alice", Email: "alice@mail.io"}, "password")
+	bob := MustCreateUser(t, ctx, userService, &goChat.User{Username: "bob", Email: "bob@mail.io"}, "password")
+	carol := MustCreateUser(t, ctx, userService, &goChat.User{Username: "carol", Email: "carol@mail.io"}, "password")
+	MustBeContacts(t, ctx, contactService, alice.Id, bob.Id)
+
+	if err := s.SetPresencePrivacy(ctx, alice.Id, goChat.AudienceContacts, goChat.AudienceNobody); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Heartbeat(ctx, alice.Id, "phone", goChat.PresenceOnline); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		viewerId     goChat.Id
+		wantStatus   goChat.PresenceStatus
+		wantLastSeen bool
+	}{
+		{"self", alice.Id, goChat.PresenceOnline, true},
+		{"contact", bob.Id, goChat.PresenceOnline, false},
+		{"stranger", carol.Id, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			presence, err := s.FindPresence(ctx, tt.viewerId, alice.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if presence.Status != tt.wantStatus {
+				t.Fatalf("Status=%q, want %q", presence.Status, tt.wantStatus)
+			}
+			if presence.LastSeen.IsZero() == tt.wantLastSeen {
+				t.Fatalf("LastSeen=%v, want visible %t", presence.LastSeen, tt.wantLastSeen)
+			}
+		})
+	}
+
+	// return EInvalid for unknown audiences
+	t.Run("invalid audience", func(t *testing.T) {
+		err := s.SetPresencePrivacy(ctx, alice.Id, "friends", goChat.AudienceNobody)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EInvalid {
+			t.Fatalf("expected EInvalid got %+v", err)
+		}
+	})
+}
+
+// unsubscribing ends the subscription's goroutine even if ctx is never done
+func TestPresenceUnsubscribe(t *testing.T) {
+	db := MustOpenDB(t)
+	defer MustCloseDB(t, db)
+	ctx := context.Background()
+
+	s := sqlite.NewPresenceService(db)
+	user := MustCreateUser(t, ctx, sqlite.NewUserService(db), &goChat.User{Username: "user0", Email: "test@mail.io"}, "password")
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		_, unsubscribe, err := s.Subscribe(ctx, user.Id, []goChat.Id{user.Id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		unsubscribe()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines leaked", runtime.NumGoroutine()-before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
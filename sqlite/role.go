@@ -0,0 +1,357 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/adamni21/goChat"
+	"github.com/mattn/go-sqlite3"
+)
+
+const roleServiceOp = "sqlite.RoleService."
+
+// RoleService represents a service for managing roles and permissions.
+type RoleService struct {
+	db *DB
+}
+
+// returns new instance of RoleService
+func NewRoleService(db *DB) *RoleService {
+	return &RoleService{db: db}
+}
+
+// Retrieves all roles, ordered by name.
+func (s *RoleService) FindRoles(ctx context.Context) ([]*goChat.Role, error) {
+	const op = roleServiceOp + "FindRoles"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, name FROM roles ORDER BY name")
+	if err != nil {
+		return nil, goChat.NewInternalErr("querying roles", op, "", err)
+	}
+	defer rows.Close()
+
+	roles := make([]*goChat.Role, 0)
+	for rows.Next() {
+		role := &goChat.Role{}
+		if err := rows.Scan(&role.Id, &role.Name); err != nil {
+			return nil, goChat.NewInternalErr("scanning row", op, "", err)
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, goChat.NewInternalErr("iterating rows", op, "", err)
+	}
+	rows.Close()
+
+	for _, role := range roles {
+		if role.Permissions, err = findRolePermissions(ctx, tx, role.Id); err != nil {
+			return nil, goChat.Error{Op: op, Err: err}
+		}
+	}
+
+	return roles, nil
+}
+
+// Retrieves the roles held by userId, ordered by name.
+func (s *RoleService) FindUserRoles(ctx context.Context, userId goChat.Id) ([]*goChat.UserRole, error) {
+	const op = roleServiceOp + "FindUserRoles"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT r.id, r.name, ur.assignedBy, ur.createdAt FROM user_roles ur
+		JOIN roles r ON r.id = ur.roleId
+		WHERE ur.userId = ?
+		ORDER BY r.name
+	`
+	rows, err := tx.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, goChat.NewInternalErr("querying user_roles", op, "", err)
+	}
+	defer rows.Close()
+
+	userRoles := make([]*goChat.UserRole, 0)
+	for rows.Next() {
+		userRole := &goChat.UserRole{UserId: userId, Role: &goChat.Role{}}
+		if err := rows.Scan(&userRole.Role.Id, &userRole.Role.Name, &userRole.AssignedBy, (*NullTime)(&userRole.CreatedAt)); err != nil {
+			return nil, goChat.NewInternalErr("scanning row", op, "", err)
+		}
+		userRoles = append(userRoles, userRole)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, goChat.NewInternalErr("iterating rows", op, "", err)
+	}
+	rows.Close()
+
+	for _, userRole := range userRoles {
+		if userRole.Role.Permissions, err = findRolePermissions(ctx, tx, userRole.Role.Id); err != nil {
+			return nil, goChat.Error{Op: op, Err: err}
+		}
+	}
+
+	return userRoles, nil
+}
+
+// Assigns the role named roleName to userId. Requires PermManageRoles.
+//
+// Returns ENotFound if the user or role doesn't exist.
+// Returns EConflict if userId already holds the role.
+func (s *RoleService) AssignRole(ctx context.Context, userId goChat.Id, roleName string) error {
+	const op = roleServiceOp + "AssignRole"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	if err = authorize(ctx, tx, op); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+	if err = assignRole(ctx, tx, userId, roleName); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
+
+// Assigns the admin role to userId without checking permissions, for
+// operators setting up a new deployment. The assignment is audited with the
+// system as actor.
+//
+// Returns EConflict if any user already holds the admin role.
+// Returns ENotFound if user doesn't exist.
+func (s *RoleService) GrantInitialAdmin(ctx context.Context, userId goChat.Id) error {
+	const op = roleServiceOp + "GrantInitialAdmin"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	admins, err := countRoleHolders(ctx, tx, goChat.RoleAdmin)
+	if err != nil {
+		return goChat.Error{Op: op, Err: err}
+	} else if admins > 0 {
+		return goChat.NewConflictErr("", op, "An admin already exists.", nil)
+	}
+
+	if err = assignRole(goChat.NewContextWithUserId(ctx, 0), tx, userId, goChat.RoleAdmin); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
+
+// Revokes the role named roleName from userId. Requires PermManageRoles.
+//
+// Returns ENotFound if userId doesn't hold the role.
+// Returns EConflict when revoking the last admin.
+func (s *RoleService) RevokeRole(ctx context.Context, userId goChat.Id, roleName string) error {
+	const op = roleServiceOp + "RevokeRole"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	if err = authorize(ctx, tx, op); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	query := `
+		DELETE FROM user_roles
+		WHERE userId = ? AND roleId = (SELECT id FROM roles WHERE name = ?)
+	`
+	result, err := tx.ExecContext(ctx, query, userId, roleName)
+	if err != nil {
+		return goChat.NewInternalErr("deleting from user_roles table", op, "", err)
+	}
+	if err = expectRowsAffected(result, op, "User doesn't have this role."); err != nil {
+		return err
+	}
+
+	// nobody could assign roles anymore
+	if roleName == goChat.RoleAdmin {
+		if admins, err := countRoleHolders(ctx, tx, goChat.RoleAdmin); err != nil {
+			return goChat.Error{Op: op, Err: err}
+		} else if admins == 0 {
+			return goChat.NewConflictErr("", op, "The last admin can't be removed.", nil)
+		}
+	}
+
+	if err = insertAuditEntry(ctx, tx, goChat.AuditRoleRevoked, userId, roleName); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
+
+// Returns true if any role of userId grants perm.
+func (s *RoleService) HasPermission(ctx context.Context, userId goChat.Id, perm goChat.Permission) (bool, error) {
+	const op = roleServiceOp + "HasPermission"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	ok, err := hasPermission(ctx, tx, userId, perm)
+	if err != nil {
+		return false, goChat.Error{Op: op, Err: err}
+	}
+	return ok, nil
+}
+
+// Permission required by each privileged operation, keyed by op.
+// authorize refuses operations missing here.
+var opPermissions = map[string]goChat.Permission{
+	roleServiceOp + "AssignRole":                 goChat.PermManageRoles,
+	roleServiceOp + "RevokeRole":                 goChat.PermManageRoles,
+	suspensionServiceOp + "Suspend":              goChat.PermManageUsers,
+	suspensionServiceOp + "Lift":                 goChat.PermManageUsers,
+	suspensionServiceOp + "FindActiveSuspension": goChat.PermManageUsers,
+	suspensionServiceOp + "FindSuspensions":      goChat.PermManageUsers,
+	auditLogServiceOp + "FindAuditEntries":       goChat.PermViewAuditLog,
+}
+
+// Checks that the user in ctx, see goChat.UserIdFromContext, holds the
+// permission opPermissions lists for operation. Operations needing a
+// permission call it with their op before doing anything else.
+//
+// Returns EUnauthorized if ctx has no user.
+// Returns EForbidden if the user lacks the permission.
+func authorize(ctx context.Context, tx *Tx, operation string) error {
+	const op = "authorize"
+
+	perm, ok := opPermissions[operation]
+	if !ok {
+		return goChat.NewInternalErr(fmt.Sprintf("no permission declared for %s", operation), op, "", nil)
+	}
+
+	userId := goChat.UserIdFromContext(ctx)
+	if userId == 0 {
+		return goChat.NewUnauthorizedErr("", op, "You need to be logged in.", nil)
+	}
+
+	ok, err := hasPermission(ctx, tx, userId, perm)
+	if err != nil {
+		return goChat.Error{Op: op, Err: err}
+	} else if !ok {
+		info := fmt.Sprintf("userId: %d, permission: %s", userId, perm)
+		return goChat.NewForbiddenErr(info, op, "You don't have permission to do this.", nil)
+	}
+	return nil
+}
+
+func hasPermission(ctx context.Context, tx *Tx, userId goChat.Id, perm goChat.Permission) (bool, error) {
+	const op = "hasPermission"
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM user_roles ur
+			JOIN role_permissions rp ON rp.roleId = ur.roleId
+			WHERE ur.userId = ? AND rp.permission = ?
+		)
+	`
+	var ok bool
+	if err := tx.QueryRowContext(ctx, query, userId, perm).Scan(&ok); err != nil {
+		return false, goChat.NewInternalErr("querying user_roles", op, "", err)
+	}
+	return ok, nil
+}
+
+func assignRole(ctx context.Context, tx *Tx, userId goChat.Id, roleName string) error {
+	const op = "assignRole"
+	info := fmt.Sprintf("userId: %d, role: %s", userId, roleName)
+
+	var roleId goChat.Id
+	err := tx.QueryRowContext(ctx, "SELECT id FROM roles WHERE name = ?", roleName).Scan(&roleId)
+	if err == sql.ErrNoRows {
+		return goChat.NewNotFoundErr(info, op, "Role not found.", nil)
+	} else if err != nil {
+		return goChat.NewInternalErr("querying roles", op, "", err)
+	}
+
+	query := `
+		INSERT INTO user_roles (userId, roleId, assignedBy, createdAt)
+		VALUES (?, ?, ?, ?)
+	`
+	_, err = tx.ExecContext(ctx, query, userId, roleId, goChat.UserIdFromContext(ctx), (*NullTime)(&tx.now))
+	if err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok {
+			switch sqliteErr.ExtendedCode {
+			case sqlite3.ErrConstraintPrimaryKey:
+				return goChat.NewConflictErr(info, op, "User already has this role.", nil)
+			case sqlite3.ErrConstraintForeignKey:
+				return goChat.NewNotFoundErr(info, op, "User not found.", nil)
+			}
+		}
+		return goChat.NewInternalErr("inserting into user_roles table", op, "", err)
+	}
+
+	return insertAuditEntry(ctx, tx, goChat.AuditRoleAssigned, userId, roleName)
+}
+
+func countRoleHolders(ctx context.Context, tx *Tx, roleName string) (int, error) {
+	const op = "countRoleHolders"
+
+	query := `
+		SELECT COUNT(*) FROM user_roles
+		WHERE roleId = (SELECT id FROM roles WHERE name = ?)
+	`
+	var n int
+	if err := tx.QueryRowContext(ctx, query, roleName).Scan(&n); err != nil {
+		return 0, goChat.NewInternalErr("counting user_roles", op, "", err)
+	}
+	return n, nil
+}
+
+func findRolePermissions(ctx context.Context, tx *Tx, roleId goChat.Id) ([]goChat.Permission, error) {
+	const op = "findRolePermissions"
+
+	rows, err := tx.QueryContext(ctx, "SELECT permission FROM role_permissions WHERE roleId = ? ORDER BY permission", roleId)
+	if err != nil {
+		return nil, goChat.NewInternalErr("querying role_permissions", op, "", err)
+	}
+	defer rows.Close()
+
+	perms := make([]goChat.Permission, 0)
+	for rows.Next() {
+		var perm goChat.Permission
+		if err := rows.Scan(&perm); err != nil {
+			return nil, goChat.NewInternalErr("scanning row", op, "", err)
+		}
+		perms = append(perms, perm)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, goChat.NewInternalErr("iterating rows", op, "", err)
+	}
+	return perms, nil
+}
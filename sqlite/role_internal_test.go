@@ -0,0 +1,59 @@
+package sqlite
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// every method calling authorize declares the permission it requires
+func TestOpPermissions(t *testing.T) {
+	fset := token.NewFileSet()
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privileged := make(map[string]bool)
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || fn.Body == nil {
+				continue
+			}
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == "authorize" {
+						recv := fn.Recv.List[0].Type.(*ast.StarExpr).X.(*ast.Ident).Name
+						privileged["sqlite."+recv+"."+fn.Name.Name] = true
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	if len(privileged) == 0 {
+		t.Fatal("found no calls to authorize")
+	}
+	for op := range privileged {
+		if _, ok := opPermissions[op]; !ok {
+			t.Errorf("%s calls authorize but has no entry in opPermissions", op)
+		}
+	}
+	for op := range opPermissions {
+		if !privileged[op] {
+			t.Errorf("opPermissions lists %s, which doesn't call authorize", op)
+		}
+	}
+}
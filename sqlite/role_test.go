@@ -0,0 +1,100 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adamni21/goChat"
+	"github.com/adamni21/goChat/sqlite"
+)
+
+func TestRoles(t *testing.T) {
+	db := MustOpenDB(t)
+	defer MustCloseDB(t, db)
+	ctx := context.Background()
+
+	s := sqlite.NewRoleService(db)
+	userService := sqlite.NewUserService(db)
+	admin := MustCreateUser(t, ctx, userService, &goChat.User{Username: "admin0", Email: "admin@mail.io"}, "password")
+	user := MustCreateUser(t, ctx, userService, &goChat.User{Username: "user0", Email: "test@mail.io"}, "password")
+	adminCtx := goChat.NewContextWithUserId(ctx, admin.Id)
+	userCtx := goChat.NewContextWithUserId(ctx, user.Id)
+
+	assertErrCode := func(t *testing.T, err error, code goChat.ErrCode) {
+		t.Helper()
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != code {
+			t.Fatalf("expected code %d got %+v", code, err)
+		}
+	}
+
+	t.Run("built-in roles", func(t *testing.T) {
+		roles, err := s.FindRoles(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(roles) != 2 || roles[0].Name != goChat.RoleAdmin || roles[1].Name != goChat.RoleModerator {
+			t.Fatalf("unexpected roles %+v", roles)
+		}
+		if len(roles[0].Permissions) != 4 {
+			t.Fatalf("admin has permissions %v", roles[0].Permissions)
+		}
+	})
+
+	t.Run("grant initial admin", func(t *testing.T) {
+		if err := s.GrantInitialAdmin(ctx, admin.Id); err != nil {
+			t.Fatal(err)
+		}
+		assertErrCode(t, s.GrantInitialAdmin(ctx, user.Id), goChat.EConflict)
+
+		ok, err := s.HasPermission(ctx, admin.Id, goChat.PermManageRoles)
+		if err != nil {
+			t.Fatal(err)
+		} else if !ok {
+			t.Fatal("admin lacks PermManageRoles")
+		}
+	})
+
+	t.Run("assign and revoke", func(t *testing.T) {
+		assertErrCode(t, s.AssignRole(ctx, user.Id, goChat.RoleModerator), goChat.EUnauthorized)
+		assertErrCode(t, s.AssignRole(userCtx, user.Id, goChat.RoleModerator), goChat.EForbidden)
+		assertErrCode(t, s.AssignRole(adminCtx, user.Id, "overlord"), goChat.ENotFound)
+
+		if err := s.AssignRole(adminCtx, user.Id, goChat.RoleModerator); err != nil {
+			t.Fatal(err)
+		}
+		assertErrCode(t, s.AssignRole(adminCtx, user.Id, goChat.RoleModerator), goChat.EConflict)
+
+		userRoles, err := s.FindUserRoles(ctx, user.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(userRoles) != 1 || userRoles[0].Role.Name != goChat.RoleModerator || userRoles[0].AssignedBy != admin.Id {
+			t.Fatalf("unexpected user roles %+v", userRoles)
+		}
+
+		// moderators can't manage roles
+		assertErrCode(t, s.RevokeRole(userCtx, admin.Id, goChat.RoleAdmin), goChat.EForbidden)
+
+		if err := s.RevokeRole(adminCtx, user.Id, goChat.RoleModerator); err != nil {
+			t.Fatal(err)
+		}
+		assertErrCode(t, s.RevokeRole(adminCtx, user.Id, goChat.RoleModerator), goChat.ENotFound)
+	})
+
+	t.Run("keep last admin", func(t *testing.T) {
+		assertErrCode(t, s.RevokeRole(adminCtx, admin.Id, goChat.RoleAdmin), goChat.EConflict)
+	})
+
+	t.Run("role changes are audited", func(t *testing.T) {
+		entries, err := sqlite.NewAuditLogService(db).FindAuditEntries(adminCtx, goChat.AuditFilter{TargetUserId: user.Id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 || entries[0].Action != goChat.AuditRoleRevoked || entries[1].Action != goChat.AuditRoleAssigned {
+			t.Fatalf("unexpected entries %+v", entries)
+		}
+
+		_, err = sqlite.NewAuditLogService(db).FindAuditEntries(userCtx, goChat.AuditFilter{})
+		assertErrCode(t, err, goChat.EForbidden)
+	})
+}
@@ -0,0 +1,356 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/adamni21/goChat"
+)
+
+const suspensionServiceOp = "sqlite.SuspensionService."
+
+// SuspensionService represents a service for suspending users.
+type SuspensionService struct {
+	db *DB
+}
+
+// returns new instance of SuspensionService
+func NewSuspensionService(db *DB) *SuspensionService {
+	return &SuspensionService{db: db}
+}
+
+// Suspends userId for duration, 0 suspends indefinitely. The acting
+// administrator is taken from ctx, see UserIdFromContext.
+// Suspended users can't log in and their sessions stop validating.
+// Requires PermManageUsers, as do all other methods.
+//
+// Returns ENotFound if user doesn't exist.
+// Returns EInvalid if reason is empty or duration is negative.
+func (s *SuspensionService) Suspend(ctx context.Context, userId goChat.Id, reason string, duration time.Duration) (*goChat.Suspension, error) {
+	const op = suspensionServiceOp + "Suspend"
+	if reason == "" {
+		return nil, goChat.NewInvalidFieldErr("reason", "", op, "A reason is required.", nil)
+	}
+	if duration < 0 {
+		return nil, goChat.NewInvalidFieldErr("duration", "", op, "Duration can't be negative.", nil)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	if err = authorize(ctx, tx, op); err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+
+	if _, err := findUserBy(ctx, tx, "id", userId); err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+
+	suspension := &goChat.Suspension{
+		UserId:    userId,
+		Reason:    reason,
+		CreatedBy: goChat.UserIdFromContext(ctx),
+		CreatedAt: tx.now,
+	}
+	if duration > 0 {
+		suspension.ExpiresAt = tx.now.Add(duration).Truncate(time.Second)
+	}
+
+	query := `
+		INSERT INTO suspensions (userId, reason, createdBy, createdAt, expiresAt)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	result, err := tx.ExecContext(
+		ctx,
+		query,
+		userId,
+		reason,
+		suspension.CreatedBy,
+		(*NullTime)(&suspension.CreatedAt),
+		(*NullTime)(&suspension.ExpiresAt),
+	)
+	if err != nil {
+		return nil, goChat.NewInternalErr("inserting into suspensions table", op, "", err)
+	}
+	if suspension.Id, err = result.LastInsertId(); err != nil {
+		return nil, goChat.NewInternalErr("getting last inserted id", op, "", err)
+	}
+
+	detail := reason
+	if !suspension.ExpiresAt.IsZero() {
+		detail = fmt.Sprintf("%s (until %s)", reason, suspension.ExpiresAt.Format(time.RFC3339))
+	}
+	if err = insertAuditEntry(ctx, tx, goChat.AuditUserSuspended, userId, detail); err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return suspension, nil
+}
+
+// Lifts the active suspensions of userId.
+//
+// Returns ENotFound if userId isn't suspended.
+func (s *SuspensionService) Lift(ctx context.Context, userId goChat.Id) error {
+	const op = suspensionServiceOp + "Lift"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	if err = authorize(ctx, tx, op); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	query := `
+		UPDATE suspensions
+		SET liftedAt = ?1, liftedBy = ?2
+		WHERE userId = ?3 AND ` + activeSuspension + `
+	`
+	result, err := tx.ExecContext(ctx, query, (*NullTime)(&tx.now), goChat.UserIdFromContext(ctx), userId)
+	if err != nil {
+		return goChat.NewInternalErr("updating suspensions table", op, "", err)
+	}
+	if err = expectRowsAffected(result, op, "User isn't suspended."); err != nil {
+		return err
+	}
+
+	if err = insertAuditEntry(ctx, tx, goChat.AuditSuspensionLifted, userId, ""); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
+
+// Retrieves the suspension of userId that is in effect.
+//
+// Returns ENotFound if userId isn't suspended.
+func (s *SuspensionService) FindActiveSuspension(ctx context.Context, userId goChat.Id) (*goChat.Suspension, error) {
+	const op = suspensionServiceOp + "FindActiveSuspension"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	if err = authorize(ctx, tx, op); err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+
+	suspension, err := findActiveSuspension(ctx, tx, userId)
+	if err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+	return suspension, nil
+}
+
+// Retrieves all suspensions of userId, most recent first.
+func (s *SuspensionService) FindSuspensions(ctx context.Context, userId goChat.Id) ([]*goChat.Suspension, error) {
+	const op = suspensionServiceOp + "FindSuspensions"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	if err = authorize(ctx, tx, op); err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+
+	query := `
+		SELECT ` + suspensionColumns + ` FROM suspensions
+		WHERE userId = ?
+		ORDER BY id DESC
+	`
+	rows, err := tx.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, goChat.NewInternalErr("querying suspensions", op, "", err)
+	}
+	defer rows.Close()
+
+	suspensions := make([]*goChat.Suspension, 0)
+	for rows.Next() {
+		suspension, err := scanSuspension(rows)
+		if err != nil {
+			return nil, goChat.NewInternalErr("scanning row", op, "", err)
+		}
+		suspensions = append(suspensions, suspension)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, goChat.NewInternalErr("iterating rows", op, "", err)
+	}
+
+	return suspensions, nil
+}
+
+// Lifts and audits the suspensions of all users that ran out.
+// Meant for background jobs, it doesn't require a permission.
+// Returns the number of lifted suspensions.
+func (s *SuspensionService) LiftExpiredSuspensions(ctx context.Context) (int, error) {
+	const op = suspensionServiceOp + "LiftExpiredSuspensions"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	n, err := liftExpiredSuspensions(ctx, tx)
+	if err != nil {
+		return 0, goChat.Error{Op: op, Err: err}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return n, nil
+}
+
+// Calls LiftExpiredSuspensions every interval until ctx is done.
+// The result of every run is passed to report, which may be nil.
+func (s *SuspensionService) RunSuspensionLifter(ctx context.Context, interval time.Duration, report func(n int, err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.LiftExpiredSuspensions(ctx)
+			if report != nil {
+				report(n, err)
+			}
+		}
+	}
+}
+
+// Condition matching suspensions in effect, expects the current time as ?1.
+// Expired suspensions no longer match even before LiftExpiredSuspensions
+// records them.
+const activeSuspension = `liftedAt IS NULL AND (expiresAt IS NULL OR expiresAt > ?1)`
+
+const suspensionColumns = `id, userId, reason, createdBy, createdAt, expiresAt, liftedAt, liftedBy`
+
+func scanSuspension(row interface{ Scan(...any) error }) (*goChat.Suspension, error) {
+	suspension := &goChat.Suspension{}
+	err := row.Scan(
+		&suspension.Id,
+		&suspension.UserId,
+		&suspension.Reason,
+		&suspension.CreatedBy,
+		(*NullTime)(&suspension.CreatedAt),
+		(*NullTime)(&suspension.ExpiresAt),
+		(*NullTime)(&suspension.LiftedAt),
+		&suspension.LiftedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return suspension, nil
+}
+
+// Retrieves the suspension of userId in effect, the one lasting longest
+// if there are several.
+//
+// Returns ENotFound if userId isn't suspended.
+func findActiveSuspension(ctx context.Context, tx *Tx, userId goChat.Id) (*goChat.Suspension, error) {
+	const op = "findActiveSuspension"
+
+	query := `
+		SELECT ` + suspensionColumns + ` FROM suspensions
+		WHERE userId = ?2 AND ` + activeSuspension + `
+		ORDER BY expiresAt IS NULL DESC, expiresAt DESC
+		LIMIT 1
+	`
+	suspension, err := scanSuspension(tx.QueryRowContext(ctx, query, (*NullTime)(&tx.now), userId))
+	if err == sql.ErrNoRows {
+		return nil, goChat.NewNotFoundErr(fmt.Sprintf("userId: %d", userId), op, "User isn't suspended.", nil)
+	} else if err != nil {
+		return nil, goChat.NewInternalErr("querying suspensions", op, "", err)
+	}
+	return suspension, nil
+}
+
+// Lifts the suspensions that ran out and records an audit entry by the
+// system for each. Returns the number of lifted suspensions.
+func liftExpiredSuspensions(ctx context.Context, tx *Tx) (int, error) {
+	const op = "liftExpiredSuspensions"
+
+	query := `
+		UPDATE suspensions
+		SET liftedAt = expiresAt, liftedBy = 0
+		WHERE liftedAt IS NULL AND expiresAt <= ?
+		RETURNING userId, expiresAt
+	`
+	rows, err := tx.QueryContext(ctx, query, (*NullTime)(&tx.now))
+	if err != nil {
+		return 0, goChat.NewInternalErr("updating suspensions table", op, "", err)
+	}
+	defer rows.Close()
+
+	type lifted struct {
+		userId    goChat.Id
+		expiresAt time.Time
+	}
+	var suspensions []lifted
+	for rows.Next() {
+		var l lifted
+		if err := rows.Scan(&l.userId, (*NullTime)(&l.expiresAt)); err != nil {
+			return 0, goChat.NewInternalErr("scanning row", op, "", err)
+		}
+		suspensions = append(suspensions, l)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, goChat.NewInternalErr("iterating rows", op, "", err)
+	}
+	rows.Close()
+
+	// the system lifts the suspension, not whoever noticed it ran out
+	systemCtx := goChat.NewContextWithUserId(ctx, 0)
+	for _, l := range suspensions {
+		detail := "expired at " + l.expiresAt.Format(time.RFC3339)
+		if err := insertAuditEntry(systemCtx, tx, goChat.AuditSuspensionExpired, l.userId, detail); err != nil {
+			return 0, goChat.Error{Op: op, Err: err}
+		}
+	}
+
+	return len(suspensions), nil
+}
+
+// Returns ESuspended if userId is suspended. It only reads, suspensions
+// that ran out are recorded by LiftExpiredSuspensions.
+//
+// The message doesn't include the reason, which is written for administrators.
+func checkNotSuspended(ctx context.Context, tx *Tx, userId goChat.Id) error {
+	const op = "checkNotSuspended"
+
+	suspension, err := findActiveSuspension(ctx, tx, userId)
+	if val, ok := err.(goChat.Error); ok && val.ErrCode() == goChat.ENotFound {
+		return nil
+	} else if err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	message := "Your account is suspended."
+	if !suspension.ExpiresAt.IsZero() {
+		message = fmt.Sprintf("Your account is suspended until %s.", suspension.ExpiresAt.Format(time.RFC1123))
+	}
+	return goChat.NewSuspendedErr(fmt.Sprintf("suspensionId: %d", suspension.Id), op, message, nil)
+}
@@ -0,0 +1,150 @@
+package sqlite_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamni21/goChat"
+	"github.com/adamni21/goChat/sqlite"
+)
+
+func TestSuspension(t *testing.T) {
+	db := MustOpenDB(t)
+	defer MustCloseDB(t, db)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	db.Now = func() time.Time { return now }
+
+	s := sqlite.NewSuspensionService(db)
+	authService := sqlite.NewAuthService(db)
+	userService := sqlite.NewUserService(db)
+	admin := MustCreateUser(t, ctx, userService, &goChat.User{Username: "admin0", Email: "admin@mail.io"}, "password")
+	user := MustCreateUser(t, ctx, userService, &goChat.User{Username: "user0", Email: "test@mail.io"}, "password")
+	session := &goChat.Session{UserId: user.Id}
+	MustCreateSession(t, ctx, db, session)
+	adminCtx := goChat.NewContextWithUserId(ctx, admin.Id)
+	if err := sqlite.NewRoleService(db).GrantInitialAdmin(ctx, admin.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	assertSuspended := func(t *testing.T, want bool) {
+		t.Helper()
+		_, loginErr := authService.Login(ctx, *user, "password", false)
+		_, sessionErr := authService.FindSession(ctx, session.Id)
+		for _, err := range []error{loginErr, sessionErr} {
+			val, ok := err.(goChat.Error)
+			if suspended := ok && val.ErrCode() == goChat.ESuspended; suspended != want {
+				t.Fatalf("suspended=%t, want %t, err %+v", suspended, want, err)
+			}
+		}
+	}
+
+	t.Run("suspend indefinitely and lift", func(t *testing.T) {
+		suspension, err := s.Suspend(adminCtx, user.Id, "spam", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if suspension.CreatedBy != admin.Id || !suspension.ExpiresAt.IsZero() {
+			t.Fatalf("unexpected suspension %+v", suspension)
+		}
+		assertSuspended(t, true)
+
+		// the reason is meant for administrators
+		_, err = authService.Login(ctx, *user, "password", false)
+		if val, ok := err.(goChat.Error); !ok || strings.Contains(val.Message, "spam") {
+			t.Fatalf("unexpected error %+v", err)
+		}
+
+		if err := s.Lift(adminCtx, user.Id); err != nil {
+			t.Fatal(err)
+		}
+		assertSuspended(t, false)
+
+		err = s.Lift(adminCtx, user.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		}
+	})
+
+	// suspension lifts automatically once it expires
+	t.Run("suspension expires", func(t *testing.T) {
+		if _, err := s.Suspend(adminCtx, user.Id, "flooding", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		assertSuspended(t, true)
+
+		now = now.Add(time.Hour)
+		assertSuspended(t, false)
+
+		// checking doesn't write, the sweep records the lift
+		suspensions, err := s.FindSuspensions(adminCtx, user.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pending := suspensions[0]; !pending.LiftedAt.IsZero() {
+			t.Fatalf("unexpected suspension %+v", pending)
+		}
+	})
+
+	t.Run("lift expired suspensions", func(t *testing.T) {
+		if n, err := s.LiftExpiredSuspensions(ctx); err != nil {
+			t.Fatal(err)
+		} else if n != 1 {
+			t.Fatalf("lifted %d suspensions, want 1", n)
+		}
+		if n, err := s.LiftExpiredSuspensions(ctx); err != nil || n != 0 {
+			t.Fatalf("expected nothing to lift got %d %v", n, err)
+		}
+
+		suspensions, err := s.FindSuspensions(adminCtx, user.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lifted := suspensions[0]; !lifted.LiftedAt.Equal(lifted.ExpiresAt) || lifted.LiftedBy != 0 {
+			t.Fatalf("unexpected suspension %+v", lifted)
+		}
+	})
+
+	t.Run("actions are audited", func(t *testing.T) {
+		entries, err := sqlite.NewAuditLogService(db).FindAuditEntries(adminCtx, goChat.AuditFilter{TargetUserId: user.Id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []struct {
+			action  string
+			actorId goChat.Id
+		}{
+			{goChat.AuditUserSuspended, admin.Id},
+			{goChat.AuditSuspensionLifted, admin.Id},
+			{goChat.AuditUserSuspended, admin.Id},
+			{goChat.AuditSuspensionExpired, 0},
+		}
+		if len(entries) != len(want) {
+			t.Fatalf("got %d entries, want %d", len(entries), len(want))
+		}
+		for i, entry := range entries {
+			// most recent first
+			if want := want[len(want)-1-i]; entry.Action != want.action || entry.ActorId != want.actorId {
+				t.Fatalf("entry %d=%+v, want action %s by %d", i, entry, want.action, want.actorId)
+			}
+		}
+	})
+
+	t.Run("requires permission", func(t *testing.T) {
+		_, err := s.Suspend(goChat.NewContextWithUserId(ctx, user.Id), admin.Id, "coup", 0)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EForbidden {
+			t.Fatalf("expected EForbidden got %+v", err)
+		}
+	})
+
+	// return EInvalid without a reason
+	t.Run("missing reason", func(t *testing.T) {
+		_, err := s.Suspend(adminCtx, user.Id, "", 0)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EInvalid {
+			t.Fatalf("expected EInvalid got %+v", err)
+		}
+	})
+}
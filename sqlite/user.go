@@ -2,9 +2,16 @@ package sqlite
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/adamni21/goChat"
 	"github.com/adamni21/goChat/crypto"
+	"github.com/mattn/go-sqlite3"
+	"golang.org/x/text/unicode/norm"
 )
 
 const userServiceOp = "sqlite.userService."
@@ -24,9 +31,19 @@ func NewUserService(db *DB) *userService {
 func (s *userService) Create(ctx context.Context, user *goChat.User, password string) error {
 	const op = userServiceOp + "Create"
 
+	var err error
+	if user.Username, err = goChat.NormalizeUsername(user.Username); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+	if user.Email, err = goChat.NormalizeEmail(user.Email); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+	if err = goChat.ValidatePassword(password); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+
 	encryptedPw, err := s.pwHasher.Generate(password)
 	if err != nil {
-		// return goChat.NewInternalErr("generating password hash", op, err)
 		return goChat.NewInternalErr("generating password hash", op, "", err)
 	}
 
@@ -38,7 +55,7 @@ func (s *userService) Create(ctx context.Context, user *goChat.User, password st
 
 	err = createUser(ctx, tx, user, encryptedPw)
 	if err != nil {
-		return goChat.NewInternalErr("", op, "", err)
+		return goChat.Error{Op: op, Err: err}
 	}
 
 	if err = tx.Commit(); err != nil {
@@ -48,26 +65,240 @@ func (s *userService) Create(ctx context.Context, user *goChat.User, password st
 	return nil
 }
 
+// Retrieves a single user by id.
+//
+// Returns ENotFound if user doesn't exist.
 func (s *userService) FindById(ctx context.Context, id goChat.Id) (*goChat.User, error) {
 	const op = userServiceOp + "FindById"
+	return s.findOne(ctx, op, "id", id)
+}
 
-	query := `
-		SELECT id, username, email, isVerified, createdAt, updatedAt
-		FROM users
-		WHERE id = ?
+// Retrieves a single user by username, ignoring case.
+//
+// Returns ENotFound if user doesn't exist.
+func (s *userService) FindByUsername(ctx context.Context, username string) (*goChat.User, error) {
+	const op = userServiceOp + "FindByUsername"
 
-	`
-	rows, err := s.db.db.QueryContext(ctx, query, id)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, goChat.NewInternalErr("querying user", op, "", err)
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	user, err := findUserByUsername(ctx, tx, username)
+	if err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+	return user, nil
+}
+
+// Retrieves a single user by email, ignoring case.
+//
+// Returns ENotFound if user doesn't exist.
+func (s *userService) FindByEmail(ctx context.Context, email string) (*goChat.User, error) {
+	const op = userServiceOp + "FindByEmail"
+	if normalized, err := goChat.NormalizeEmail(email); err == nil {
+		email = normalized
+	}
+	return s.findOne(ctx, op, "email", email)
+}
+
+// Retrieves users matching filter, ordered by id.
+// Also returns the total number of users matching filter, ignoring
+// AfterId and Limit.
+func (s *userService) FindUsers(ctx context.Context, filter goChat.UserFilter) ([]*goChat.User, int, error) {
+	const op = userServiceOp + "FindUsers"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	users, n, err := findUsers(ctx, tx, filter)
+	if err != nil {
+		return nil, 0, goChat.Error{Op: op, Err: err}
+	}
+
+	return users, n, nil
+}
+
+// Updates the fields set in upd and returns the updated user.
+//
+// Returns ENotFound if user doesn't exist.
+func (s *userService) Update(ctx context.Context, id goChat.Id, upd goChat.UserUpdate) (*goChat.User, error) {
+	const op = userServiceOp + "Update"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	user, err := updateUser(ctx, tx, id, upd)
+	if err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return user, nil
+}
+
+// Updates the profile fields set in upd and returns the updated user.
+//
+// Returns ENotFound if user doesn't exist.
+// Returns EInvalid if a field exceeds its max length.
+func (s *userService) UpdateProfile(ctx context.Context, id goChat.Id, upd goChat.ProfileUpdate) (*goChat.User, error) {
+	const op = userServiceOp + "UpdateProfile"
+
+	if err := goChat.ValidateProfileUpdate(upd); err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	user, err := updateProfile(ctx, tx, id, upd)
+	if err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
 	}
-	defer rows.Close()
 
-	rows.Next()
+	if err = tx.Commit(); err != nil {
+		return nil, goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return user, nil
+}
+
+// Retrieves the public profile of a user.
+//
+// Returns ENotFound if user doesn't exist.
+func (s *userService) FindPublicProfile(ctx context.Context, id goChat.Id) (*goChat.PublicProfile, error) {
+	const op = userServiceOp + "FindPublicProfile"
+	user, err := s.findOne(ctx, op, "id", id)
+	if err != nil {
+		return nil, err
+	}
+	return user.PublicProfile(), nil
+}
+
+// Permanently deletes user and everything referencing it, such as sessions.
+//
+// Returns ENotFound if user doesn't exist.
+// Returns EConflict when deleting the last admin.
+func (s *userService) Delete(ctx context.Context, id goChat.Id) error {
+	const op = userServiceOp + "Delete"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	if err = deleteUser(ctx, tx, id); err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
+
+func (s *userService) findOne(ctx context.Context, op, column string, value any) (*goChat.User, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	user, err := findUserBy(ctx, tx, column, value)
+	if err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+
+	return user, nil
+}
+
+// Columns selected by scanUser, in order.
+const userColumns = `
+	id, username, email, isVerified,
+	displayName, bio, avatarRef, pronouns, status, statusExpiry,
+	createdAt, updatedAt, version
+`
+
+// Assignments incrementing the version past the one scanUser reports,
+// which counts an expired status as a change. The expired status is
+// cleared, so reads return the version written. Expects the current time
+// as ?1.
+const bumpVersion = `
+	version = version + 1 + (statusExpiry IS NOT NULL AND statusExpiry <= ?1),
+	status = iif(statusExpiry IS NOT NULL AND statusExpiry <= ?1, '', status),
+	statusExpiry = iif(statusExpiry IS NOT NULL AND statusExpiry <= ?1, NULL, statusExpiry)
+`
+
+// Scans a row selected with userColumns.
+// An expired status is cleared relative to now.
+func scanUser(row interface{ Scan(...any) error }, now time.Time) (*goChat.User, error) {
 	user := &goChat.User{}
-	err = rows.Scan(&user.Id, &user.Username, &user.Email, &user.Verified, (*NullTime)(&user.CreatedAt), (*NullTime)(&user.UpdatedAt))
+	err := row.Scan(
+		&user.Id,
+		&user.Username,
+		&user.Email,
+		&user.Verified,
+		&user.Profile.DisplayName,
+		&user.Profile.Bio,
+		&user.Profile.AvatarRef,
+		&user.Profile.Pronouns,
+		&user.Profile.Status,
+		(*NullTime)(&user.Profile.StatusExpiry),
+		(*NullTime)(&user.CreatedAt),
+		(*NullTime)(&user.UpdatedAt),
+		&user.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// expiring changes the profile without a write, so count it as an update
+	if expiry := user.Profile.StatusExpiry; !expiry.IsZero() && !now.Before(expiry) {
+		user.Profile.Status = ""
+		user.Profile.StatusExpiry = time.Time{}
+		user.Version++
+		if expiry.After(user.UpdatedAt) {
+			user.UpdatedAt = expiry
+		}
+	}
+
+	return user, nil
+}
+
+// Retrieves a single user where column equals value.
+// column must be a trusted identifier, it is not escaped.
+//
+// Returns ENotFound if user doesn't exist.
+func findUserBy(ctx context.Context, tx *Tx, column string, value any) (*goChat.User, error) {
+	const op = userServiceOp + "findUserBy"
+
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE ` + column + ` = ?
+	`
+	user, err := scanUser(tx.QueryRowContext(ctx, query, value), tx.now)
 	if err != nil {
-		return nil, goChat.NewInternalErr("scanning row", op, "", err)
+		info := fmt.Sprintf("%s: %v", column, value)
+		if err == sql.ErrNoRows {
+			return nil, goChat.NewNotFoundErr(info, op, "User not found.", nil)
+		}
+		return nil, goChat.NewInternalErr(info, op, "", err)
 	}
 
 	return user, nil
@@ -78,22 +309,27 @@ func createUser(ctx context.Context, tx *Tx, user *goChat.User, encryptedPw stri
 
 	user.CreatedAt = tx.now
 	user.UpdatedAt = tx.now
+	user.Version = 1
 
 	query := `
 		INSERT INTO users (
 			username,
+			usernameSkeleton,
+			usernameLower,
 			email,
     		isVerified,
     		passwordString,
 			createdAt,
 			updatedAt
 		)
-		VALUES (?, ?, ?, ?, ?, ?)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	result, err := tx.ExecContext(
 		ctx,
 		query,
 		user.Username,
+		goChat.UsernameSkeleton(user.Username),
+		strings.ToLower(user.Username),
 		user.Email,
 		false,
 		encryptedPw,
@@ -101,6 +337,9 @@ func createUser(ctx context.Context, tx *Tx, user *goChat.User, encryptedPw stri
 		(*NullTime)(&user.UpdatedAt),
 	)
 	if err != nil {
+		if conflictErr, ok := userConflictErr(err, op); ok {
+			return conflictErr
+		}
 		return goChat.NewInternalErr("inserting into users table", op, "", err)
 	}
 
@@ -111,3 +350,282 @@ func createUser(ctx context.Context, tx *Tx, user *goChat.User, encryptedPw stri
 
 	return nil
 }
+
+func findUsers(ctx context.Context, tx *Tx, filter goChat.UserFilter) ([]*goChat.User, int, error) {
+	const op = userServiceOp + "findUsers"
+
+	where, args := []string{"1 = 1"}, []any{}
+	if v := filter.UsernamePrefix; v != nil {
+		// usernameLower is lower cased in Go, sqlite's lower() only folds ASCII.
+		// range instead of LIKE so users_usernameLower_idx can be used
+		prefix := strings.ToLower(norm.NFKC.String(*v))
+		where = append(where, "usernameLower >= ? AND usernameLower < ?")
+		args = append(args, prefix, prefix+string(utf8.MaxRune))
+	}
+	if v := filter.Verified; v != nil {
+		where = append(where, "isVerified = ?")
+		args = append(args, *v)
+	}
+	if v := filter.CreatedAfter; v != nil {
+		where = append(where, "createdAt > ?")
+		args = append(args, (*NullTime)(v))
+	}
+	if v := filter.CreatedBefore; v != nil {
+		where = append(where, "createdAt < ?")
+		args = append(args, (*NullTime)(v))
+	}
+	whereClause := strings.Join(where, " AND ")
+
+	var n int
+	countQuery := "SELECT COUNT(*) FROM users WHERE " + whereClause
+	if err := tx.QueryRowContext(ctx, countQuery, args...).Scan(&n); err != nil {
+		return nil, 0, goChat.NewInternalErr("counting users", op, "", err)
+	}
+
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE ` + whereClause + ` AND id > ?
+		ORDER BY id
+	`
+	args = append(args, filter.AfterId)
+	if filter.Limit > 0 {
+		query += "LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, goChat.NewInternalErr("querying users", op, "", err)
+	}
+	defer rows.Close()
+
+	users := make([]*goChat.User, 0)
+	for rows.Next() {
+		user, err := scanUser(rows, tx.now)
+		if err != nil {
+			return nil, 0, goChat.NewInternalErr("scanning row", op, "", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, goChat.NewInternalErr("iterating rows", op, "", err)
+	}
+
+	return users, n, nil
+}
+
+// Retrieves a single user by username, ignoring case.
+//
+// Returns ENotFound if user doesn't exist.
+func findUserByUsername(ctx context.Context, tx *Tx, username string) (*goChat.User, error) {
+	const op = "findUserByUsername"
+	user, err := findUserBy(ctx, tx, "usernameSkeleton", goChat.UsernameSkeleton(username))
+	if err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+	// the skeleton also matches look-alikes, only accept a case-insensitive match
+	if !strings.EqualFold(user.Username, strings.TrimSpace(norm.NFKC.String(username))) {
+		return nil, goChat.NewNotFoundErr(fmt.Sprintf("username: %s", username), op, "User not found.", nil)
+	}
+	return user, nil
+}
+
+func updateUser(ctx context.Context, tx *Tx, id goChat.Id, upd goChat.UserUpdate) (*goChat.User, error) {
+	const op = userServiceOp + "updateUser"
+
+	user, err := findUserBy(ctx, tx, "id", id)
+	if err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+
+	if upd.Username != nil {
+		if user.Username, err = goChat.NormalizeUsername(*upd.Username); err != nil {
+			return nil, goChat.Error{Op: op, Err: err}
+		}
+	}
+	user.UpdatedAt = tx.now
+	user.Version++
+
+	// the status is written too, so one scanUser cleared isn't counted again
+	query := `
+		UPDATE users
+		SET username = ?, usernameSkeleton = ?, usernameLower = ?, status = ?, statusExpiry = ?, updatedAt = ?, version = ?
+		WHERE id = ?
+	`
+	_, err = tx.ExecContext(
+		ctx,
+		query,
+		user.Username,
+		goChat.UsernameSkeleton(user.Username),
+		strings.ToLower(user.Username),
+		user.Profile.Status,
+		(*NullTime)(&user.Profile.StatusExpiry),
+		(*NullTime)(&user.UpdatedAt),
+		user.Version,
+		id,
+	)
+	if err != nil {
+		if conflictErr, ok := userConflictErr(err, op); ok {
+			return nil, conflictErr
+		}
+		return nil, goChat.NewInternalErr("updating users table", op, "", err)
+	}
+
+	return user, nil
+}
+
+// Sets the email of user id to the normalized email. Callers are
+// responsible for the address being confirmed.
+//
+// Returns EConflict if email is already registered.
+func updateEmail(ctx context.Context, tx *Tx, id goChat.Id, email string) error {
+	const op = userServiceOp + "updateEmail"
+
+	email, err := goChat.NormalizeEmail(email)
+	if err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	query := `
+		UPDATE users
+		SET email = ?2, updatedAt = ?1, ` + bumpVersion + `
+		WHERE id = ?3
+	`
+	if _, err = tx.ExecContext(ctx, query, (*NullTime)(&tx.now), email, id); err != nil {
+		if conflictErr, ok := userConflictErr(err, op); ok {
+			return conflictErr
+		}
+		return goChat.NewInternalErr("updating users table", op, "", err)
+	}
+	return nil
+}
+
+func updateProfile(ctx context.Context, tx *Tx, id goChat.Id, upd goChat.ProfileUpdate) (*goChat.User, error) {
+	const op = userServiceOp + "updateProfile"
+
+	user, err := findUserBy(ctx, tx, "id", id)
+	if err != nil {
+		return nil, goChat.Error{Op: op, Err: err}
+	}
+
+	profile := &user.Profile
+	if v := upd.DisplayName; v != nil {
+		profile.DisplayName = *v
+	}
+	if v := upd.Bio; v != nil {
+		profile.Bio = *v
+	}
+	if v := upd.AvatarRef; v != nil {
+		profile.AvatarRef = *v
+	}
+	if v := upd.Pronouns; v != nil {
+		profile.Pronouns = *v
+	}
+	if v := upd.Status; v != nil {
+		// a new status doesn't inherit the expiry of the previous one
+		profile.Status, profile.StatusExpiry = *v, time.Time{}
+	}
+	if v := upd.StatusExpiry; v != nil {
+		profile.StatusExpiry = v.UTC().Truncate(time.Second)
+	}
+	user.UpdatedAt = tx.now
+	user.Version++
+
+	query := `
+		UPDATE users
+		SET displayName = ?, bio = ?, avatarRef = ?, pronouns = ?, status = ?, statusExpiry = ?, updatedAt = ?, version = ?
+		WHERE id = ?
+	`
+	_, err = tx.ExecContext(
+		ctx,
+		query,
+		profile.DisplayName,
+		profile.Bio,
+		profile.AvatarRef,
+		profile.Pronouns,
+		profile.Status,
+		(*NullTime)(&profile.StatusExpiry),
+		(*NullTime)(&user.UpdatedAt),
+		user.Version,
+		id,
+	)
+	if err != nil {
+		return nil, goChat.NewInternalErr("updating users table", op, "", err)
+	}
+
+	return user, nil
+}
+
+// Maps a UNIQUE constraint violation on the users table to EConflict
+// with the offending field. Returns false for any other error.
+func userConflictErr(err error, op string) (goChat.Error, bool) {
+	sqliteErr, ok := err.(sqlite3.Error)
+	if !ok || sqliteErr.ExtendedCode != sqlite3.ErrConstraintUnique {
+		return goChat.Error{}, false
+	}
+
+	switch msg := sqliteErr.Error(); {
+	case strings.Contains(msg, "username"):
+		return goChat.NewConflictFieldErr("username", "", op, "Username is already taken.", err), true
+	case strings.Contains(msg, "email"):
+		return goChat.NewConflictFieldErr("email", "", op, "Email address is already registered.", err), true
+	}
+	return goChat.NewConflictErr("", op, "", err), true
+}
+
+func updatePasswordDigest(ctx context.Context, tx *Tx, id goChat.Id, passwordDigest string) error {
+	const op = userServiceOp + "updatePasswordDigest"
+
+	query := `
+		UPDATE users
+		SET passwordString = ?, updatedAt = ?
+		WHERE id = ?
+	`
+	result, err := tx.ExecContext(ctx, query, passwordDigest, (*NullTime)(&tx.now), id)
+	if err != nil {
+		return goChat.NewInternalErr("updating users table", op, "", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return goChat.NewInternalErr("getting rows affected", op, "", err)
+	}
+	if n == 0 {
+		return goChat.NewNotFoundErr(fmt.Sprintf("id: %d", id), op, "User not found.", nil)
+	}
+
+	return nil
+}
+
+func deleteUser(ctx context.Context, tx *Tx, id goChat.Id) error {
+	const op = userServiceOp + "deleteUser"
+
+	admins, err := countRoleHolders(ctx, tx, goChat.RoleAdmin)
+	if err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	// everything referencing the user is removed by ON DELETE CASCADE
+	result, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return goChat.NewInternalErr("deleting from users table", op, "", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return goChat.NewInternalErr("getting rows affected", op, "", err)
+	}
+	if n == 0 {
+		return goChat.NewNotFoundErr(fmt.Sprintf("id: %d", id), op, "User not found.", nil)
+	}
+
+	// nobody could assign roles anymore, as in RevokeRole
+	if admins > 0 {
+		if remaining, err := countRoleHolders(ctx, tx, goChat.RoleAdmin); err != nil {
+			return goChat.Error{Op: op, Err: err}
+		} else if remaining == 0 {
+			return goChat.NewConflictErr(fmt.Sprintf("id: %d", id), op, "The last admin can't be deleted.", nil)
+		}
+	}
+
+	return nil
+}
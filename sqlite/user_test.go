@@ -3,9 +3,12 @@ package sqlite_test
 import (
 	"context"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/adamni21/goChat"
+	"github.com/adamni21/goChat/inmem"
 	"github.com/adamni21/goChat/sqlite"
 )
 
@@ -47,6 +50,17 @@ func TestCreate(t *testing.T) {
 			t.Fatalf("persisted user=%#v, want %#v", persistedUser, user)
 		}
 	})
+
+	// return EInvalid if password violates the password policy
+	t.Run("weak password", func(t *testing.T) {
+		s, _, closeDB, ctx := InitUserService(t)
+		defer closeDB()
+
+		err := s.Create(ctx, &goChat.User{Username: "user0", Email: "mail@mail.com"}, "short")
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EInvalid || val.ErrField() != "password" {
+			t.Fatalf("expected EInvalid for password got %+v", err)
+		}
+	})
 }
 
 func TestFindById(t *testing.T) {
@@ -73,6 +87,399 @@ func TestFindById(t *testing.T) {
 	})
 }
 
+func TestFindByIdNotFound(t *testing.T) {
+	s, _, closeDB, ctx := InitUserService(t)
+	defer closeDB()
+
+	_, err := s.FindById(ctx, 1)
+	if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+		t.Fatalf("expected ENotFound got %+v", err)
+	}
+}
+
+func TestFindByUsernameAndEmail(t *testing.T) {
+	s, _, closeDB, ctx := InitUserService(t)
+	defer closeDB()
+
+	user := MustCreateUser(t, ctx, s, &goChat.User{Username: "user0", Email: "mail@mail.com"}, "password")
+
+	t.Run("find by username", func(t *testing.T) {
+		foundUser, err := s.FindByUsername(ctx, user.Username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(user, foundUser) {
+			t.Fatalf("found user=%#v, want %#v", foundUser, user)
+		}
+	})
+
+	t.Run("find by email", func(t *testing.T) {
+		foundUser, err := s.FindByEmail(ctx, user.Email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(user, foundUser) {
+			t.Fatalf("found user=%#v, want %#v", foundUser, user)
+		}
+	})
+
+	t.Run("user doesn't exist", func(t *testing.T) {
+		_, err := s.FindByUsername(ctx, "nobody")
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		}
+		_, err = s.FindByEmail(ctx, "nobody@mail.com")
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		}
+	})
+}
+
+func TestCreateConflict(t *testing.T) {
+	s, _, closeDB, ctx := InitUserService(t)
+	defer closeDB()
+
+	MustCreateUser(t, ctx, s, &goChat.User{Username: "paypal", Email: "pay@mail.com"}, "password")
+
+	tests := []struct {
+		name  string
+		user  goChat.User
+		field string
+	}{
+		{"username differs in case", goChat.User{Username: "PayPal", Email: "other@mail.com"}, "username"},
+		{"username is confusable", goChat.User{Username: "pаypa1", Email: "other@mail.com"}, "username"},
+		{"email differs in case", goChat.User{Username: "other", Email: "PAY@mail.com"}, "email"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Create(ctx, &tt.user, "password")
+			val, ok := err.(goChat.Error)
+			if !ok || val.ErrCode() != goChat.EConflict {
+				t.Fatalf("expected EConflict got %+v", err)
+			}
+			if val.ErrField() != tt.field {
+				t.Fatalf("field=%s, want %s", val.ErrField(), tt.field)
+			}
+		})
+	}
+
+	// return EInvalid if username violates rules
+	t.Run("invalid username", func(t *testing.T) {
+		err := s.Create(ctx, &goChat.User{Username: "a b", Email: "other@mail.com"}, "password")
+		val, ok := err.(goChat.Error)
+		if !ok || val.ErrCode() != goChat.EInvalid || val.ErrField() != "username" {
+			t.Fatalf("expected EInvalid for username got %+v", err)
+		}
+	})
+
+	t.Run("find by username ignores case", func(t *testing.T) {
+		user, err := s.FindByUsername(ctx, "PAYPAL")
+		if err != nil {
+			t.Fatal(err)
+		} else if user.Username != "paypal" {
+			t.Fatalf("Username=%s, want %s", user.Username, "paypal")
+		}
+	})
+}
+
+func TestFindUsers(t *testing.T) {
+	s, _, closeDB, ctx := InitUserService(t)
+	defer closeDB()
+
+	alice := MustCreateUser(t, ctx, s, &goChat.User{Username: "Alice", Email: "alice@mail.com"}, "password")
+	alfred := MustCreateUser(t, ctx, s, &goChat.User{Username: "alfred", Email: "alfred@mail.com"}, "password")
+	MustCreateUser(t, ctx, s, &goChat.User{Username: "bob", Email: "bob@mail.com"}, "password")
+
+	t.Run("case-insensitive username prefix", func(t *testing.T) {
+		prefix := "AL"
+		users, n, err := s.FindUsers(ctx, goChat.UserFilter{UsernamePrefix: &prefix})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 2 {
+			t.Fatalf("n=%d, want %d", n, 2)
+		}
+		if !reflect.DeepEqual(users, []*goChat.User{alice, alfred}) {
+			t.Fatalf("users=%+v, want %+v", users, []*goChat.User{alice, alfred})
+		}
+	})
+
+	t.Run("keyset pagination", func(t *testing.T) {
+		users, n, err := s.FindUsers(ctx, goChat.UserFilter{Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		} else if n != 3 {
+			t.Fatalf("n=%d, want %d", n, 3)
+		} else if len(users) != 2 {
+			t.Fatalf("len(users)=%d, want %d", len(users), 2)
+		}
+
+		users, n, err = s.FindUsers(ctx, goChat.UserFilter{AfterId: users[1].Id, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		} else if n != 3 {
+			t.Fatalf("n=%d, want %d", n, 3)
+		} else if len(users) != 1 || users[0].Username != "bob" {
+			t.Fatalf("users=%+v, want only bob", users)
+		}
+	})
+
+	t.Run("filter by verified", func(t *testing.T) {
+		verified := true
+		users, n, err := s.FindUsers(ctx, goChat.UserFilter{Verified: &verified})
+		if err != nil {
+			t.Fatal(err)
+		} else if n != 0 || len(users) != 0 {
+			t.Fatalf("expected no users got n=%d users=%+v", n, users)
+		}
+	})
+
+	t.Run("non-ASCII username prefix", func(t *testing.T) {
+		elodie := MustCreateUser(t, ctx, s, &goChat.User{Username: "Élodie", Email: "elodie@mail.com"}, "password")
+		prefix := "éL"
+		users, _, err := s.FindUsers(ctx, goChat.UserFilter{UsernamePrefix: &prefix})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 1 || users[0].Id != elodie.Id {
+			t.Fatalf("unexpected users %+v", users)
+		}
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	s, _, closeDB, ctx := InitUserService(t)
+	defer closeDB()
+
+	user := MustCreateUser(t, ctx, s, &goChat.User{Username: "user0", Email: "mail@mail.com"}, "password")
+
+	t.Run("update username only", func(t *testing.T) {
+		username := "user1"
+		updated, err := s.Update(ctx, user.Id, goChat.UserUpdate{Username: &username})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Username != username {
+			t.Fatalf("Username=%s, want %s", updated.Username, username)
+		} else if updated.Email != user.Email {
+			t.Fatalf("Email=%s, want %s", updated.Email, user.Email)
+		}
+
+		persistedUser, err := s.FindById(ctx, user.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(updated, persistedUser) {
+			t.Fatalf("persisted user=%#v, want %#v", persistedUser, updated)
+		}
+	})
+
+	t.Run("user doesn't exist", func(t *testing.T) {
+		_, err := s.Update(ctx, -1, goChat.UserUpdate{})
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		}
+	})
+}
+
+func TestUpdateProfile(t *testing.T) {
+	s, _, closeDB, ctx := InitUserService(t)
+	defer closeDB()
+
+	user := MustCreateUser(t, ctx, s, &goChat.User{Username: "user0", Email: "mail@mail.com"}, "password")
+
+	t.Run("update profile", func(t *testing.T) {
+		displayName, status := "User Zero", "busy"
+		expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		updated, err := s.UpdateProfile(ctx, user.Id, goChat.ProfileUpdate{
+			DisplayName:  &displayName,
+			Status:       &status,
+			StatusExpiry: &expiry,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := goChat.Profile{DisplayName: displayName, Status: status, StatusExpiry: expiry}
+		if !reflect.DeepEqual(updated.Profile, want) {
+			t.Fatalf("Profile=%+v, want %+v", updated.Profile, want)
+		}
+
+		profile, err := s.FindPublicProfile(ctx, user.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(profile, updated.PublicProfile()) {
+			t.Fatalf("public profile=%+v, want %+v", profile, updated.PublicProfile())
+		}
+	})
+
+	// status is cleared once it has expired
+	t.Run("expired status", func(t *testing.T) {
+		status := "away"
+		expiry := time.Now().Add(-time.Hour)
+		if _, err := s.UpdateProfile(ctx, user.Id, goChat.ProfileUpdate{Status: &status, StatusExpiry: &expiry}); err != nil {
+			t.Fatal(err)
+		}
+
+		profile, err := s.FindPublicProfile(ctx, user.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if profile.Profile.Status != "" || !profile.Profile.StatusExpiry.IsZero() {
+			t.Fatalf("expected status to be cleared got %+v", profile.Profile)
+		}
+	})
+
+	// return EInvalid if a field is too long
+	t.Run("bio too long", func(t *testing.T) {
+		bio := strings.Repeat("a", goChat.MaxBioLength+1)
+		_, err := s.UpdateProfile(ctx, user.Id, goChat.ProfileUpdate{Bio: &bio})
+		val, ok := err.(goChat.Error)
+		if !ok || val.ErrCode() != goChat.EInvalid || val.ErrField() != "bio" {
+			t.Fatalf("expected EInvalid for bio got %+v", err)
+		}
+	})
+}
+
+// every change increases the version, even within the same second
+func TestProfileVersion(t *testing.T) {
+	s, db, closeDB, ctx := InitUserService(t)
+	defer closeDB()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	db.Now = func() time.Time { return now }
+	user := MustCreateUser(t, ctx, s, &goChat.User{Username: "user0", Email: "mail@mail.com"}, "password")
+
+	status, bio, expiry := "busy", "hi", now.Add(time.Minute)
+	updated, err := s.UpdateProfile(ctx, user.Id, goChat.ProfileUpdate{Status: &status, StatusExpiry: &expiry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Version != user.Version+1 {
+		t.Fatalf("Version=%d, want %d", updated.Version, user.Version+1)
+	}
+
+	// the status expiring is a change without a write
+	now = expiry
+	profile, err := s.FindPublicProfile(ctx, user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Version != updated.Version+1 || !profile.UpdatedAt.Equal(expiry) {
+		t.Fatalf("Version=%d UpdatedAt=%s, want %d %s", profile.Version, profile.UpdatedAt, updated.Version+1, expiry)
+	}
+
+	updated, err = s.UpdateProfile(ctx, user.Id, goChat.ProfileUpdate{Bio: &bio})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Version != profile.Version+1 {
+		t.Fatalf("Version=%d, want %d", updated.Version, profile.Version+1)
+	}
+	if persisted, err := s.FindById(ctx, user.Id); err != nil {
+		t.Fatal(err)
+	} else if persisted.Version != updated.Version {
+		t.Fatalf("persisted Version=%d, want %d", persisted.Version, updated.Version)
+	}
+
+	// writes after the status expired return the version read afterwards
+	t.Run("update after expiry", func(t *testing.T) {
+		expiry := now.Add(time.Minute)
+		if _, err := s.UpdateProfile(ctx, user.Id, goChat.ProfileUpdate{Status: &status, StatusExpiry: &expiry}); err != nil {
+			t.Fatal(err)
+		}
+		now = expiry
+
+		username := "user1"
+		updated, err := s.Update(ctx, user.Id, goChat.UserUpdate{Username: &username})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if persisted, err := s.FindById(ctx, user.Id); err != nil {
+				t.Fatal(err)
+			} else if persisted.Version != updated.Version || persisted.Profile.Status != "" {
+				t.Fatalf("persisted Version=%d Status=%q, want %d and no status", persisted.Version, persisted.Profile.Status, updated.Version)
+			}
+		}
+	})
+
+	t.Run("verify after expiry", func(t *testing.T) {
+		expiry := now.Add(time.Minute)
+		if _, err := s.UpdateProfile(ctx, user.Id, goChat.ProfileUpdate{Status: &status, StatusExpiry: &expiry}); err != nil {
+			t.Fatal(err)
+		}
+		mailer := inmem.NewMailer()
+		verificationService := sqlite.NewVerificationService(db, mailer)
+		if err := verificationService.SendVerification(ctx, user.Id); err != nil {
+			t.Fatal(err)
+		}
+		now = expiry
+
+		before, err := s.FindById(ctx, user.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := verificationService.Verify(ctx, TokenFromMail(t, mailer.Mails()[0])); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if persisted, err := s.FindById(ctx, user.Id); err != nil {
+				t.Fatal(err)
+			} else if persisted.Version != before.Version+1 {
+				t.Fatalf("persisted Version=%d, want %d", persisted.Version, before.Version+1)
+			}
+		}
+	})
+}
+
+func TestDelete(t *testing.T) {
+	authService, db, closeDB, ctx := InitAuthService(t)
+	s := sqlite.NewUserService(db)
+	defer closeDB()
+
+	user := MustCreateUser(t, ctx, s, &goChat.User{Username: "user0", Email: "mail@mail.com"}, "password")
+	session := &goChat.Session{UserId: user.Id}
+	MustCreateSession(t, ctx, db, session)
+
+	t.Run("delete user and sessions", func(t *testing.T) {
+		if err := s.Delete(ctx, user.Id); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := s.FindById(ctx, user.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		}
+		_, err = authService.FindSession(ctx, session.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected session to be deleted got %+v", err)
+		}
+	})
+
+	t.Run("user doesn't exist", func(t *testing.T) {
+		err := s.Delete(ctx, user.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		}
+	})
+
+	// return EConflict when deleting the last admin
+	t.Run("keep last admin", func(t *testing.T) {
+		admin := MustCreateUser(t, ctx, s, &goChat.User{Username: "admin0", Email: "admin@mail.com"}, "password")
+		if err := sqlite.NewRoleService(db).GrantInitialAdmin(ctx, admin.Id); err != nil {
+			t.Fatal(err)
+		}
+		err := s.Delete(ctx, admin.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EConflict {
+			t.Fatalf("expected EConflict got %+v", err)
+		}
+		if _, err := s.FindById(ctx, admin.Id); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
 // pass shared db if used by multiple services, otherwise pass nil
 func InitUserService(t testing.TB) (goChat.UserService, *sqlite.DB, func(), context.Context) {
 	t.Helper()
@@ -0,0 +1,152 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/adamni21/goChat"
+	"github.com/adamni21/goChat/crypto"
+)
+
+const verificationServiceOp = "sqlite.VerificationService."
+
+// VerificationService represents a service for verifying email addresses.
+type VerificationService struct {
+	db     *DB
+	mailer goChat.Mailer
+
+	// How long an issued token stays valid.
+	TokenLifetime time.Duration
+	// Min time between two verification mails to the same user.
+	ResendInterval time.Duration
+}
+
+// returns new instance of VerificationService
+func NewVerificationService(db *DB, mailer goChat.Mailer) *VerificationService {
+	return &VerificationService{
+		db:             db,
+		mailer:         mailer,
+		TokenLifetime:  24 * time.Hour,
+		ResendInterval: time.Minute,
+	}
+}
+
+// Issues a new single-use verification token for the specified user
+// and mails it to the user's email address.
+// Does nothing if the user is already verified.
+//
+// Returns ENotFound if user doesn't exist.
+// Returns ERateLimited if a token was sent to the user too recently.
+func (s *VerificationService) SendVerification(ctx context.Context, userId goChat.Id) error {
+	const op = verificationServiceOp + "SendVerification"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	user, err := findUserBy(ctx, tx, "id", userId)
+	if err != nil {
+		return goChat.Error{Op: op, Err: err}
+	}
+	if user.Verified {
+		return nil
+	}
+
+	var lastSent NullTime
+	query := `
+		SELECT max(createdAt) FROM verification_tokens
+		WHERE userId = ?
+	`
+	if err = tx.QueryRowContext(ctx, query, userId).Scan(&lastSent); err != nil {
+		return goChat.NewInternalErr("querying last verification token", op, "", err)
+	}
+	if wait := time.Time(lastSent).Add(s.ResendInterval).Sub(tx.now); wait > 0 {
+		info := fmt.Sprintf("userId: %d, retry after: %s", userId, wait)
+		return goChat.NewRateLimitedErr(info, op, "Verification mail was sent recently, try again later.", nil)
+	}
+
+	token, err := crypto.GenerateToken()
+	if err != nil {
+		return goChat.NewInternalErr("generating token", op, "", err)
+	}
+	expiry := tx.now.Add(s.TokenLifetime)
+
+	query = `
+		INSERT INTO verification_tokens (tokenHash, userId, expiry, createdAt)
+		VALUES (?, ?, ?, ?)
+	`
+	_, err = tx.ExecContext(ctx, query, crypto.HashToken(token), userId, (*NullTime)(&expiry), (*NullTime)(&tx.now))
+	if err != nil {
+		return goChat.NewInternalErr("inserting into verification_tokens table", op, "", err)
+	}
+
+	// commit before mailing so the write lock isn't held during delivery
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	err = s.mailer.Send(ctx, goChat.Mail{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf("Use this code to verify your email address:\n\n%s\n\nThe code expires at %s.", token, expiry.Format(time.RFC1123)),
+	})
+	if err != nil {
+		// a failed delivery shouldn't count towards ResendInterval
+		if delErr := s.db.execTx(ctx, "DELETE FROM verification_tokens WHERE tokenHash = ?", crypto.HashToken(token)); delErr != nil {
+			return goChat.NewInternalErr("deleting undelivered token", op, "", delErr)
+		}
+		return goChat.Error{Op: op, Err: err}
+	}
+
+	return nil
+}
+
+// Marks the user the token was issued for as verified and invalidates
+// all of the user's verification tokens.
+//
+// Returns ENotFound if token doesn't exist or has expired.
+func (s *VerificationService) Verify(ctx context.Context, token string) error {
+	const op = verificationServiceOp + "Verify"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return goChat.NewInternalErr("beginning transaction", op, "", err)
+	}
+	defer tx.Rollback()
+
+	var userId goChat.Id
+	var expiry time.Time
+	query := `
+		SELECT userId, expiry FROM verification_tokens
+		WHERE tokenHash = ?
+	`
+	err = tx.QueryRowContext(ctx, query, crypto.HashToken(token)).Scan(&userId, (*NullTime)(&expiry))
+	if err == sql.ErrNoRows || (err == nil && !tx.now.Before(expiry)) {
+		return goChat.NewNotFoundErr("", op, "Invalid or expired verification code.", nil)
+	} else if err != nil {
+		return goChat.NewInternalErr("querying verification token", op, "", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM verification_tokens WHERE userId = ?", userId); err != nil {
+		return goChat.NewInternalErr("deleting verification tokens", op, "", err)
+	}
+
+	query = `
+		UPDATE users
+		SET isVerified = 1, updatedAt = ?1, ` + bumpVersion + `
+		WHERE id = ?2
+	`
+	if _, err = tx.ExecContext(ctx, query, (*NullTime)(&tx.now), userId); err != nil {
+		return goChat.NewInternalErr("updating users table", op, "", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goChat.NewInternalErr("committing transaction", op, "", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/adamni21/goChat"
+	"github.com/adamni21/goChat/inmem"
+	"github.com/adamni21/goChat/sqlite"
+)
+
+func TestVerification(t *testing.T) {
+	s, mailer, db, closeDB, ctx := InitVerificationService(t)
+	userService := sqlite.NewUserService(db)
+	defer closeDB()
+
+	user := MustCreateUser(t, ctx, userService, &goChat.User{Username: "user0", Email: "test@mail.io"}, "password")
+
+	if err := s.SendVerification(ctx, user.Id); err != nil {
+		t.Fatal(err)
+	}
+	mail, ok := mailer.LastMailTo(user.Email)
+	if !ok {
+		t.Fatal("expected verification mail")
+	}
+	token := TokenFromMail(t, mail)
+
+	// return ERateLimited if resent within ResendInterval
+	t.Run("resend too early", func(t *testing.T) {
+		err := s.SendVerification(ctx, user.Id)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ERateLimited {
+			t.Fatalf("expected ERateLimited got %+v", err)
+		}
+	})
+
+	// return ENotFound if token is unknown
+	t.Run("invalid token", func(t *testing.T) {
+		err := s.Verify(ctx, "invalid")
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		}
+	})
+
+	t.Run("verify successfully", func(t *testing.T) {
+		if err := s.Verify(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+		verifiedUser, err := userService.FindById(ctx, user.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !verifiedUser.Verified {
+			t.Fatal("expected user to be verified")
+		}
+	})
+
+	// token is single-use
+	t.Run("reuse token", func(t *testing.T) {
+		err := s.Verify(ctx, token)
+		if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+			t.Fatalf("expected ENotFound got %+v", err)
+		}
+	})
+}
+
+// a failed delivery doesn't count towards ResendInterval
+func TestVerificationMailFails(t *testing.T) {
+	s, mailer, db, cleanup, ctx := InitVerificationService(t)
+	defer cleanup()
+	user := MustCreateUser(t, ctx, sqlite.NewUserService(db), &goChat.User{Username: "user0", Email: "test@mail.io"}, "password")
+
+	err := sqlite.NewVerificationService(db, failingMailer{}).SendVerification(ctx, user.Id)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if err := s.SendVerification(ctx, user.Id); err != nil {
+		t.Fatal(err)
+	}
+	if len(mailer.Mails()) != 1 {
+		t.Fatalf("got %d mails, want 1", len(mailer.Mails()))
+	}
+}
+
+func TestExpiredVerificationToken(t *testing.T) {
+	s, mailer, db, closeDB, ctx := InitVerificationService(t)
+	userService := sqlite.NewUserService(db)
+	defer closeDB()
+
+	user := MustCreateUser(t, ctx, userService, &goChat.User{Username: "user0", Email: "test@mail.io"}, "password")
+
+	s.TokenLifetime = 0
+	if err := s.SendVerification(ctx, user.Id); err != nil {
+		t.Fatal(err)
+	}
+	mail, _ := mailer.LastMailTo(user.Email)
+
+	err := s.Verify(ctx, TokenFromMail(t, mail))
+	if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.ENotFound {
+		t.Fatalf("expected ENotFound got %+v", err)
+	}
+}
+
+// return EUnauthorized if RequireVerifiedEmail is set and user isn't verified
+func TestLoginRequiresVerifiedEmail(t *testing.T) {
+	db := MustOpenDB(t)
+	defer MustCloseDB(t, db)
+	ctx := context.Background()
+
+	authService := sqlite.NewAuthService(db)
+	authService.RequireVerifiedEmail = true
+	user := MustCreateUser(t, ctx, sqlite.NewUserService(db), &goChat.User{Username: "user0", Email: "test@mail.io"}, "password")
+
+	_, err := authService.Login(ctx, *user, "password", false)
+	if val, ok := err.(goChat.Error); !ok || val.ErrCode() != goChat.EUnauthorized {
+		t.Fatalf("expected EUnauthorized got %+v", err)
+	}
+}
+
+// returns the token mailed on its own line after the first blank line
+func TokenFromMail(tb testing.TB, mail goChat.Mail) string {
+	tb.Helper()
+	parts := strings.SplitN(mail.Body, "\n\n", 3)
+	if len(parts) < 2 || parts[1] == "" {
+		tb.Fatalf("no token in mail body %q", mail.Body)
+	}
+	return parts[1]
+}
+
+func InitVerificationService(tb testing.TB) (*sqlite.VerificationService, *inmem.Mailer, *sqlite.DB, func(), context.Context) {
+	tb.Helper()
+	db := MustOpenDB(tb)
+	mailer := inmem.NewMailer()
+	s := sqlite.NewVerificationService(db, mailer)
+	return s, mailer, db, func() { MustCloseDB(tb, db) }, context.Background()
+}
+
+// failingMailer fails every delivery.
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, mail goChat.Mail) error {
+	return goChat.NewInternalErr("", "failingMailer.Send", "", errors.New("delivery failed"))
+}
@@ -0,0 +1,57 @@
+package goChat
+
+import (
+	"context"
+	"time"
+)
+
+// Represents a user being suspended by an administrator.
+type Suspension struct {
+	Id     Id
+	UserId Id
+	Reason string
+	// Id of the administrator, 0 if the system suspended the user.
+	CreatedBy Id
+
+	CreatedAt time.Time
+	// Zero means the suspension doesn't expire.
+	ExpiresAt time.Time
+	// Zero until the suspension is lifted. A suspension that ran out is
+	// lifted by the system, LiftedBy 0, with LiftedAt set to ExpiresAt.
+	LiftedAt time.Time
+	LiftedBy Id
+}
+
+// Returns true if the suspension is in effect at now.
+func (s *Suspension) Active(now time.Time) bool {
+	return s.LiftedAt.IsZero() && (s.ExpiresAt.IsZero() || now.Before(s.ExpiresAt))
+}
+
+type SuspensionService interface {
+	// Suspends userId for duration, 0 suspends indefinitely. The acting
+	// administrator is taken from ctx, see UserIdFromContext.
+	// Suspended users can't log in and their sessions stop validating.
+	// Requires PermManageUsers, as do all other methods.
+	//
+	// Returns ENotFound if user doesn't exist.
+	// Returns EInvalid if reason is empty or duration is negative.
+	Suspend(ctx context.Context, userId Id, reason string, duration time.Duration) (*Suspension, error)
+
+	// Lifts the active suspensions of userId.
+	//
+	// Returns ENotFound if userId isn't suspended.
+	Lift(ctx context.Context, userId Id) error
+
+	// Retrieves the suspension of userId that is in effect.
+	//
+	// Returns ENotFound if userId isn't suspended.
+	FindActiveSuspension(ctx context.Context, userId Id) (*Suspension, error)
+
+	// Retrieves all suspensions of userId, most recent first.
+	FindSuspensions(ctx context.Context, userId Id) ([]*Suspension, error)
+
+	// Lifts and audits the suspensions of all users that ran out.
+	// Meant for background jobs, it doesn't require a permission.
+	// Returns the number of lifted suspensions.
+	LiftExpiredSuspensions(ctx context.Context) (int, error)
+}
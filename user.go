@@ -13,13 +13,130 @@ type User struct {
 	Email    string
 	Verified bool
 
+	Profile Profile
+
 	Chats []Chat
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	// Incremented on every change of the user, including a status expiring.
+	Version int64
+}
+
+// Represents the user editable, publicly visible part of a user.
+type Profile struct {
+	DisplayName string
+	Bio         string
+	// Reference to the avatar blob, empty if the user has none.
+	AvatarRef string
+	Pronouns  string
+
+	// Custom status text, cleared once StatusExpiry has passed.
+	Status string
+	// Zero means the status doesn't expire.
+	StatusExpiry time.Time
+}
+
+// Represents the public view of a user, without private fields such as email.
+// Version increases whenever the profile changes, so clients can use it to
+// invalidate cached profiles.
+type PublicProfile struct {
+	Id       Id
+	Username string
+	Profile  Profile
+
+	UpdatedAt time.Time
+	Version   int64
+}
+
+// Returns the public view of user.
+func (u *User) PublicProfile() *PublicProfile {
+	return &PublicProfile{
+		Id:        u.Id,
+		Username:  u.Username,
+		Profile:   u.Profile,
+		UpdatedAt: u.UpdatedAt,
+		Version:   u.Version,
+	}
+}
+
+// Represents fields that can be updated on a profile.
+// Nil fields are left unchanged, set a field to "" to clear it.
+type ProfileUpdate struct {
+	DisplayName  *string
+	Bio          *string
+	AvatarRef    *string
+	Pronouns     *string
+	Status       *string
+	StatusExpiry *time.Time
+}
+
+// Represents fields that can be updated on a user.
+// Nil fields are left unchanged. The email address is changed through
+// EmailChangeService, so the new address gets confirmed.
+type UserUpdate struct {
+	Username *string
+}
+
+// Represents a filter used by FindUsers.
+// Nil fields are ignored.
+type UserFilter struct {
+	// Case-insensitive prefix of the username.
+	UsernamePrefix *string
+	Verified       *bool
+	CreatedAfter   *time.Time
+	CreatedBefore  *time.Time
+
+	// Keyset pagination, only users with an id greater than AfterId are returned.
+	// Pass the id of the last user of the previous page.
+	AfterId Id
+	// Max number of users returned, 0 means no limit.
+	Limit int
 }
 
 type UserService interface {
+	// Creates a new user and sets user.Id, user.CreatedAt and user.UpdatedAt.
 	Create(ctx context.Context, user *User, password string) error
+
+	// Retrieves a single user by id.
+	//
+	// Returns ENotFound if user doesn't exist.
 	FindById(ctx context.Context, id Id) (*User, error)
+
+	// Retrieves a single user by username.
+	//
+	// Returns ENotFound if user doesn't exist.
+	FindByUsername(ctx context.Context, username string) (*User, error)
+
+	// Retrieves a single user by email.
+	//
+	// Returns ENotFound if user doesn't exist.
+	FindByEmail(ctx context.Context, email string) (*User, error)
+
+	// Retrieves users matching filter, ordered by id.
+	// Also returns the total number of users matching filter, ignoring
+	// AfterId and Limit.
+	FindUsers(ctx context.Context, filter UserFilter) ([]*User, int, error)
+
+	// Updates the fields set in upd and returns the updated user.
+	//
+	// Returns ENotFound if user doesn't exist.
+	Update(ctx context.Context, id Id, upd UserUpdate) (*User, error)
+
+	// Updates the profile fields set in upd and returns the updated user.
+	//
+	// Returns ENotFound if user doesn't exist.
+	// Returns EInvalid if a field exceeds its max length.
+	UpdateProfile(ctx context.Context, id Id, upd ProfileUpdate) (*User, error)
+
+	// Retrieves the public profile of a user.
+	//
+	// Returns ENotFound if user doesn't exist.
+	FindPublicProfile(ctx context.Context, id Id) (*PublicProfile, error)
+
+	// Permanently deletes user and everything referencing it, such as sessions.
+	//
+	// Returns ENotFound if user doesn't exist.
+	// Returns EConflict when deleting the last admin.
+	Delete(ctx context.Context, id Id) error
 }
@@ -0,0 +1,148 @@
+package goChat
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	MaxDisplayNameLength = 64
+	MaxBioLength         = 500
+	MaxPronounsLength    = 32
+	MaxStatusLength      = 100
+	MaxAvatarRefLength   = 256
+	MaxNicknameLength    = 64
+)
+
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 32
+	MaxEmailLength    = 254
+)
+
+// Usernames that can't be registered, compared by skeleton.
+var reservedUsernames = map[string]struct{}{
+	"admin":         {},
+	"administrator": {},
+	"deleted":       {},
+	"gochat":        {},
+	"moderator":     {},
+	"null":          {},
+	"root":          {},
+	"support":       {},
+	"system":        {},
+	"undefined":     {},
+}
+
+// Characters that look like a latin letter or digit, mapped to it.
+// A subset of the Unicode confusables list, applied after lower casing.
+var confusables = map[rune]rune{
+	'0': 'o', '1': 'l', 'ı': 'i', 'ℓ': 'l',
+	// cyrillic
+	'а': 'a', 'в': 'b', 'ԁ': 'd', 'е': 'e', 'ё': 'e', 'һ': 'h', 'і': 'i', 'ї': 'i',
+	'ј': 'j', 'к': 'k', 'ӏ': 'l', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'ԛ': 'q',
+	'г': 'r', 'ѕ': 's', 'т': 't', 'ѵ': 'v', 'ԝ': 'w', 'х': 'x', 'у': 'y',
+	// greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'γ': 'y',
+}
+
+// Letter sequences that look like a single latin letter.
+var confusableSequences = strings.NewReplacer("rn", "m", "vv", "w")
+
+// Normalizes username to NFKC and checks it against the username rules.
+// Returns the normalized username.
+//
+// Returns EInvalid with Field "username" if username violates the rules.
+func NormalizeUsername(username string) (string, error) {
+	const op = "goChat.NormalizeUsername"
+	username = strings.TrimSpace(norm.NFKC.String(username))
+
+	invalid := func(message string) error {
+		return NewInvalidFieldErr("username", fmt.Sprintf("username: %q", username), op, message, nil)
+	}
+
+	n := utf8.RuneCountInString(username)
+	if n < MinUsernameLength || n > MaxUsernameLength {
+		return "", invalid(fmt.Sprintf("Username must be between %d and %d characters long.", MinUsernameLength, MaxUsernameLength))
+	}
+	for i, r := range username {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+		case unicode.Is(unicode.Mn, r) && i > 0:
+		case (r == '_' || r == '.' || r == '-') && i > 0:
+		default:
+			return "", invalid("Username may only contain letters, digits, '_', '.' and '-' and must start with a letter or digit.")
+		}
+	}
+	if _, ok := reservedUsernames[UsernameSkeleton(username)]; ok {
+		return "", invalid("Username is reserved.")
+	}
+
+	return username, nil
+}
+
+// Returns a case-folded form of username in which visually confusable
+// characters are mapped to the same latin letter. Two usernames with the
+// same skeleton are considered the same name.
+func UsernameSkeleton(username string) string {
+	username = strings.ToLower(norm.NFKC.String(username))
+	// strip combining marks so 'é' and 'e' collide
+	decomposed := norm.NFD.String(username)
+	var b strings.Builder
+	for _, r := range decomposed {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		b.WriteRune(r)
+	}
+	return confusableSequences.Replace(b.String())
+}
+
+// Normalizes email to NFKC lower case and checks that it's a plain address.
+// Returns the normalized email.
+//
+// Returns EInvalid with Field "email" if email isn't valid.
+func NormalizeEmail(email string) (string, error) {
+	const op = "goChat.NormalizeEmail"
+	email = strings.ToLower(strings.TrimSpace(norm.NFKC.String(email)))
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" || len(email) > MaxEmailLength {
+		return "", NewInvalidFieldErr("email", fmt.Sprintf("email: %q", email), op, "Invalid email address.", err)
+	}
+
+	return email, nil
+}
+
+// Checks the fields set in upd against their max length.
+//
+// Returns EInvalid with the offending Field if a field is too long.
+func ValidateProfileUpdate(upd ProfileUpdate) error {
+	const op = "goChat.ValidateProfileUpdate"
+	fields := []struct {
+		name  string
+		value *string
+		max   int
+	}{
+		{"displayName", upd.DisplayName, MaxDisplayNameLength},
+		{"bio", upd.Bio, MaxBioLength},
+		{"avatarRef", upd.AvatarRef, MaxAvatarRefLength},
+		{"pronouns", upd.Pronouns, MaxPronounsLength},
+		{"status", upd.Status, MaxStatusLength},
+	}
+	for _, f := range fields {
+		if f.value != nil && utf8.RuneCountInString(*f.value) > f.max {
+			return NewInvalidFieldErr(f.name, "", op, fmt.Sprintf("Must be at most %d characters long.", f.max), nil)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package goChat_test
+
+import (
+	"testing"
+
+	"github.com/adamni21/goChat"
+)
+
+func TestNormalizeUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		want     string
+		valid    bool
+	}{
+		{"user0", "user0", true},
+		{"  Ｕser_0 ", "User_0", true},
+		{"émile.b", "émile.b", true},
+		{"ab", "", false},
+		{"_user", "", false},
+		{"user name", "", false},
+		{"user@name", "", false},
+		{"Admin", "", false},
+		{"аdmin", "", false}, // cyrillic а
+	}
+	for _, tt := range tests {
+		got, err := goChat.NormalizeUsername(tt.username)
+		if tt.valid && err != nil {
+			t.Errorf("NormalizeUsername(%q) unexpected error %v", tt.username, err)
+		} else if !tt.valid && err == nil {
+			t.Errorf("NormalizeUsername(%q) expected error", tt.username)
+		} else if got != tt.want {
+			t.Errorf("NormalizeUsername(%q)=%q, want %q", tt.username, got, tt.want)
+		}
+	}
+}
+
+func TestUsernameSkeleton(t *testing.T) {
+	pairs := [][2]string{
+		{"paypal", "PayPal"},
+		{"paypal", "pаypa1"},
+		{"modern", "rnodern"},
+		{"emile", "émile"},
+	}
+	for _, p := range pairs {
+		if a, b := goChat.UsernameSkeleton(p[0]), goChat.UsernameSkeleton(p[1]); a != b {
+			t.Errorf("skeleton(%q)=%q != skeleton(%q)=%q", p[0], a, p[1], b)
+		}
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	if got, err := goChat.NormalizeEmail(" Test@Mail.IO "); err != nil || got != "test@mail.io" {
+		t.Errorf("got %q %v, want %q", got, err, "test@mail.io")
+	}
+	for _, email := range []string{"", "test", "Test <test@mail.io>", "test@"} {
+		if _, err := goChat.NormalizeEmail(email); err == nil {
+			t.Errorf("NormalizeEmail(%q) expected error", email)
+		}
+	}
+}
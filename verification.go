@@ -0,0 +1,19 @@
+package goChat
+
+import "context"
+
+type VerificationService interface {
+	// Issues a new single-use verification token for the specified user
+	// and mails it to the user's email address.
+	// Does nothing if the user is already verified.
+	//
+	// Returns ENotFound if user doesn't exist.
+	// Returns ERateLimited if a token was sent to the user too recently.
+	SendVerification(ctx context.Context, userId Id) error
+
+	// Marks the user the token was issued for as verified and invalidates
+	// all of the user's verification tokens.
+	//
+	// Returns ENotFound if token doesn't exist or has expired.
+	Verify(ctx context.Context, token string) error
+}